@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	outputFormat string
+	applyCmd     = &cobra.Command{
+		Use:   "apply <settings.json>",
+		Short: "Create or update a Workspace from a settings file",
+		Long: "Create the Workspace for a WorkspaceSettings JSON file, or update it if it already exists, in " +
+			"the current kubeconfig context exactly as the manager would.",
+		Args: cobra.ExactArgs(1),
+		Run:  runApply,
+	}
+	getCmd = &cobra.Command{
+		Use:   "get <name>",
+		Short: "Show a Workspace and its status",
+		Args:  cobra.ExactArgs(1),
+		Run:   runGet,
+	}
+	listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List Workspaces and their status",
+		Args:  cobra.NoArgs,
+		Run:   runList,
+	}
+	deleteCmd = &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a Workspace",
+		Args:  cobra.ExactArgs(1),
+		Run:   runDelete,
+	}
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{getCmd, listCmd} {
+		cmd.Flags().StringVarP(&outputFormat, "output", "o", outputTable, "Output format: table, json or yaml")
+	}
+	rootCmd.AddCommand(applyCmd, getCmd, listCmd, deleteCmd)
+}
+
+// runApply creates or updates the Workspace for a settings file
+func runApply(cmd *cobra.Command, args []string) {
+	appConfig, k8sClient := adminClient(cmd)
+
+	payload, err := readSettingsFile(args[0])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read workspace settings")
+	}
+
+	ctx := context.Background()
+	_, err = k8s.GetWorkspace(ctx, k8sClient, payload.Name, appConfig)
+	switch {
+	case apierrors.IsNotFound(err):
+		err = k8s.CreateWorkspace(ctx, k8sClient, payload, appConfig)
+	case err == nil:
+		err = k8s.UpdateWorkspace(ctx, k8sClient, payload, appConfig)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to apply workspace")
+	}
+}
+
+// runGet prints a single Workspace
+func runGet(cmd *cobra.Command, args []string) {
+	appConfig, k8sClient := adminClient(cmd)
+
+	workspace, err := k8s.GetWorkspace(context.Background(), k8sClient, args[0], appConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to get workspace")
+	}
+
+	if err := printWorkspace(cmd.OutOrStdout(), outputFormat, *workspace); err != nil {
+		log.Fatal().Err(err).Msg("Failed to print workspace")
+	}
+}
+
+// runList prints every Workspace in the configured namespace
+func runList(cmd *cobra.Command, args []string) {
+	appConfig, k8sClient := adminClient(cmd)
+
+	workspaces, err := k8s.ListWorkspaces(context.Background(), k8sClient, appConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to list workspaces")
+	}
+
+	if err := printWorkspaceList(cmd.OutOrStdout(), outputFormat, workspaces); err != nil {
+		log.Fatal().Err(err).Msg("Failed to print workspaces")
+	}
+}
+
+// runDelete deletes a Workspace by name, failing if it does not exist
+func runDelete(cmd *cobra.Command, args []string) {
+	appConfig, k8sClient := adminClient(cmd)
+
+	// Unlike a deleting message, deleting a missing workspace is reported because the name is
+	// probably wrong
+	ctx := context.Background()
+	if _, err := k8s.GetWorkspace(ctx, k8sClient, args[0], appConfig); err != nil {
+		log.Fatal().Err(err).Msg("Failed to delete workspace")
+	}
+
+	err := k8s.DeleteWorkspace(ctx, k8sClient, models.WorkspaceSettings{Name: args[0]}, appConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to delete workspace")
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Workspace %s/%s deleted\n", appConfig.Kubernetes.Namespace, args[0])
+}
+
+// adminClient loads the configuration and connects to the cluster in the current kubeconfig context
+func adminClient(cmd *cobra.Command) (*utils.Config, client.Client) {
+	appConfig := loadConfig(cmd)
+	utils.InitLogger(appConfig.LogLevel)
+
+	if outputFormat != outputTable && outputFormat != outputJSON && outputFormat != outputYAML {
+		log.Fatal().Str("output", outputFormat).Msg("Unknown output format")
+	}
+
+	k8sClient, err := k8s.NewClient()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create Kubernetes client")
+	}
+	return appConfig, k8sClient
+}
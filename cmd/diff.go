@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <settings.json>",
+	Short: "Compare the Workspace CR for a settings file against the cluster",
+	Long: "Compare the Workspace CR that the manager would write for a WorkspaceSettings JSON file against " +
+		"the live CR in the current kubeconfig context. The status in the file selects the operation, and " +
+		"files without one are compared as an update. Exits with status 0 if there are no differences, 1 if " +
+		"there are and 2 if the diff could not be computed.",
+	Args: cobra.ExactArgs(1),
+	Run:  runDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
+
+// Exit statuses of the diff command. Errors use their own status so that they are not mistaken
+// for differences.
+const (
+	diffExitNone    = 0
+	diffExitChanges = 1
+	diffExitError   = 2
+)
+
+// runDiff prints the changes a settings file would make to the live Workspace
+func runDiff(cmd *cobra.Command, args []string) {
+	diff, err := diffSettingsFile(cmd, args[0])
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to diff workspace")
+	} else {
+		printDiff(cmd.OutOrStdout(), diff)
+	}
+	os.Exit(diffExitCode(diff, err))
+}
+
+// diffSettingsFile compares the Workspace for a settings file against the live Workspace
+func diffSettingsFile(cmd *cobra.Command, path string) (*k8s.WorkspaceDiff, error) {
+	appConfig, err := utils.ReadConfig(configFile, configOverrides(cmd))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration file: %w", err)
+	}
+	utils.InitLogger(appConfig.LogLevel)
+
+	payload, err := readSettingsFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace settings: %w", err)
+	}
+	if payload.Status == "" {
+		payload.Status = "updating"
+	}
+
+	k8sClient, err := k8s.NewClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	return k8s.DiffWorkspace(context.Background(), k8sClient, appConfig, payload)
+}
+
+// diffExitCode returns the exit status for the result of a diff
+func diffExitCode(diff *k8s.WorkspaceDiff, err error) int {
+	switch {
+	case err != nil:
+		return diffExitError
+	case diff.Operation != k8s.DiffNone:
+		return diffExitChanges
+	default:
+		return diffExitNone
+	}
+}
+
+// printDiff writes a diff with one line per changed field: + for added, - for removed and ~ for
+// changed fields
+func printDiff(w io.Writer, diff *k8s.WorkspaceDiff) {
+	fmt.Fprintf(w, "Workspace %s/%s: %s\n", diff.Namespace, diff.Name, diff.Operation)
+	for _, change := range diff.Changes {
+		switch {
+		case change.Old == nil:
+			fmt.Fprintf(w, "+ %s: %s\n", change.Path, formatValue(change.New))
+		case change.New == nil:
+			fmt.Fprintf(w, "- %s: %s\n", change.Path, formatValue(change.Old))
+		default:
+			fmt.Fprintf(w, "~ %s: %s -> %s\n", change.Path, formatValue(change.Old), formatValue(change.New))
+		}
+	}
+}
+
+// formatValue formats a field value as JSON
+func formatValue(v any) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
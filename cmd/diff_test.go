@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffExitCode(t *testing.T) {
+	assert.Equal(t, 0, diffExitCode(&k8s.WorkspaceDiff{Operation: k8s.DiffNone}, nil))
+	assert.Equal(t, 1, diffExitCode(&k8s.WorkspaceDiff{Operation: k8s.DiffUpdate}, nil))
+	assert.Equal(t, 1, diffExitCode(&k8s.WorkspaceDiff{Operation: k8s.DiffCreate}, nil))
+
+	// Errors are distinguishable from differences
+	assert.Equal(t, 2, diffExitCode(nil, errors.New("connection refused")))
+}
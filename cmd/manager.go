@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/health"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/messaging"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/transport"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/rs/zerolog/log"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var errShuttingDown = errors.New("shutting down")
+
+// statusRetryDelay is how long the producer loop waits after failing to publish a status update,
+// so that a broker outage does not turn requeued updates into a busy loop
+const statusRetryDelay = time.Second
+
+// connectionCheckInterval is how often the settings source is checked for a broker connection
+const connectionCheckInterval = 10 * time.Second
+
+// dryRunProperty is the message property that requests a dry run for a single settings message
+const dryRunProperty = "dry-run"
+
+// workspaceManager holds the clients shared by the consumer and producer loops
+type workspaceManager struct {
+	configs     *utils.ConfigStore
+	k8sClient   client.Client
+	settings    transport.SettingsSource
+	status      transport.StatusSink
+	deadLetters *messaging.DeadLetterQueue
+	serializer  *messaging.KeySerializer
+	statusQueue *k8s.StatusQueue
+	components  *health.Components
+	// inFlight holds a slot for every message received but not yet settled, so that no more than
+	// maxInFlight are held at once
+	inFlight chan struct{}
+}
+
+// consumeSettings receives workspace-settings messages until ctx is cancelled and hands them to
+// the serializer. Work runs on workCtx so that it is not interrupted when receiving stops.
+//
+// A message is only received once one of the maxInFlight slots is free, and holds it until it is
+// settled, so that after an outage the backlog stays on the broker rather than being pulled into
+// memory and applied all at once.
+func (m *workspaceManager) consumeSettings(ctx, workCtx context.Context) {
+	m.components.MarkHealthy(health.ConsumerLoop)
+	for m.acquireSlot(ctx) {
+		msg, err := m.settings.Receive(ctx)
+		if ctx.Err() != nil {
+			m.releaseSlot()
+			break
+		}
+		if err != nil {
+			m.releaseSlot()
+			// Receive only fails once the source is closed, so stop and let the liveness probe fail
+			log.Error().Err(err).Msg("Error receiving workspace-settings message; consumer loop stopped")
+			m.components.MarkFailed(health.SettingsConsumer, err)
+			m.components.MarkFailed(health.ConsumerLoop, err)
+			return
+		}
+
+		// Decode the message into WorkspaceSettings. Malformed messages and unsupported schema
+		// versions will never succeed so skip the retries
+		envelope, payload, err := messaging.DecodeSettings(msg.Payload())
+		if err != nil {
+			metrics.SettingsMessagesReceived.WithLabelValues(metrics.StatusLabel("")).Inc()
+			reason := messaging.ReasonMalformedPayload
+			if errors.Is(err, messaging.ErrUnsupportedVersion) {
+				reason = messaging.ReasonUnsupportedVersion
+			}
+			log.Error().Err(err).Str("message_id", msg.ID()).Msg("Failed to decode workspace-settings message")
+			outcome := m.deadLetters.Reject(workCtx, m.settings, msg, reason, err)
+			metrics.ObserveOutcome("", outcome)
+			m.releaseSlot()
+			continue
+		}
+		metrics.SettingsMessagesReceived.WithLabelValues(metrics.StatusLabel(payload.Status)).Inc()
+		log.Debug().Str("workspace", payload.Name).Int("schema_version", envelope.SchemaVersion).Str("message_id", envelope.MessageID).
+			Str("correlation_id", envelope.CorrelationID).Time("emitted_at", envelope.EmittedAt).Msg("Received workspace-settings message")
+
+		// Process the workspace settings message. Messages for different workspaces are handled
+		// concurrently, but messages for the same workspace are processed in the order received
+		m.serializer.Submit(payload.Name, func() {
+			defer m.releaseSlot()
+			m.handleSettings(workCtx, msg, envelope, payload)
+		})
+	}
+
+	log.Info().Msg("Stopped receiving workspace-settings messages")
+	m.components.MarkFailed(health.ConsumerLoop, errShuttingDown)
+}
+
+// monitorSettingsConsumer checks every interval, until ctx is cancelled, that the settings source
+// can reach the broker, and records the result for the readiness probe. Receive blocks rather than
+// failing while the broker is unreachable, so the consumer loop cannot tell.
+func (m *workspaceManager) monitorSettingsConsumer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := m.settings.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		connected := m.components.Check(health.SettingsConsumer) == nil
+		if err != nil {
+			if connected {
+				log.Error().Err(err).Msg("Workspace-settings consumer cannot reach the broker")
+			}
+			m.components.MarkFailed(health.SettingsConsumer, err)
+			continue
+		}
+		if !connected {
+			log.Info().Msg("Workspace-settings consumer reconnected to the broker")
+		}
+		m.components.MarkHealthy(health.SettingsConsumer)
+	}
+}
+
+// acquireSlot waits until fewer than maxInFlight messages are held, reporting false if ctx is
+// cancelled first
+func (m *workspaceManager) acquireSlot(ctx context.Context) bool {
+	select {
+	case m.inFlight <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseSlot frees the slot of a message that has been settled
+func (m *workspaceManager) releaseSlot() {
+	<-m.inFlight
+}
+
+// handleSettings applies a workspace-settings message to the cluster and settles it. The whole
+// message is handled with the configuration active when it started.
+//
+// Failed attempts are retried here with backoff rather than nacked, so that later messages for the
+// workspace wait until this one is acknowledged or dead-lettered. Otherwise a later message could
+// be applied before the redelivered one, for example recreating a workspace deleted in between.
+// Permanent errors, which no retry can fix, are dead-lettered straight away so that they do not
+// hold back later messages.
+func (m *workspaceManager) handleSettings(ctx context.Context, msg transport.Message, envelope models.Envelope, payload models.WorkspaceSettings) {
+	config := m.configs.Get()
+	retry := config.Retry()
+	backoff := messaging.ExponentialBackoff{Initial: retry.InitialBackoff, Max: retry.MaxBackoff}
+
+	// Messages redelivered after a restart have already used some of their attempts
+	attempt := msg.RedeliveryCount()
+	var err error
+	for {
+		err = k8s.ProcessWorkspace(ctx, m.k8sClient, config, payload, isDryRun(config, msg))
+		if err == nil || k8s.IsPermanent(err) || ctx.Err() != nil || attempt >= retry.MaxRedeliveries {
+			break
+		}
+
+		delay := backoff.Next(attempt)
+		log.Warn().Err(err).Str("workspace", payload.Name).Str("correlation_id", envelope.CorrelationID).Str("error_class", k8s.ErrorClass(err)).Uint32("attempt", attempt+1).Dur("retry_in", delay).Msg("Failed to process workspace settings message; retrying")
+		metrics.ObserveOutcome(payload.Status, metrics.OutcomeRetried)
+		attempt++
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	// Work abandoned at the shutdown deadline is redelivered rather than counted as a failure
+	if ctx.Err() != nil {
+		log.Warn().Str("workspace", payload.Name).Msg("Shutdown deadline reached; message will be redelivered")
+		m.settings.Nack(msg)
+		metrics.ObserveOutcome(payload.Status, metrics.OutcomeNacked)
+		return
+	}
+
+	if k8s.IsPermanent(err) {
+		log.Error().Err(err).Str("workspace", payload.Name).Str("correlation_id", envelope.CorrelationID).Msg("Invalid workspace settings message; sending it to the dead-letter topic")
+		outcome := m.deadLetters.Reject(ctx, m.settings, msg, messaging.ReasonInvalidSettings, err)
+		metrics.ObserveOutcome(payload.Status, outcome)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("workspace", payload.Name).Str("correlation_id", envelope.CorrelationID).Str("error_class", k8s.ErrorClass(err)).Uint32("attempts", attempt+1).Msg("Failed to process workspace settings message; sending it to the dead-letter topic")
+	} else {
+		log.Info().Str("workspace", payload.Name).Str("correlation_id", envelope.CorrelationID).Msg("Message successfully processed and acknowledged")
+	}
+	outcome := m.deadLetters.Settle(ctx, m.settings, msg, err)
+	metrics.ObserveOutcome(payload.Status, outcome)
+}
+
+// isDryRun reports whether a settings message should only be diffed against the cluster, either
+// because dry-run mode is enabled or because the message asks for it
+func isDryRun(config *utils.Config, msg transport.Message) bool {
+	if config.DryRun {
+		return true
+	}
+	dryRun, _ := strconv.ParseBool(msg.Properties()[dryRunProperty])
+	return dryRun
+}
+
+// publishStatusUpdates publishes workspace-status updates until ctx is cancelled, which also
+// abandons a send in progress so that shutdown does not wait for it. Updates still buffered after
+// that, and an abandoned one, which is requeued, are left for drainStatusUpdates.
+func (m *workspaceManager) publishStatusUpdates(ctx context.Context, updates <-chan models.WorkspaceStatus) {
+	for {
+		select {
+		case statusUpdate := <-updates:
+			if err := m.publishStatus(ctx, statusUpdate); err != nil {
+				select {
+				case <-time.After(statusRetryDelay):
+				case <-ctx.Done():
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drainStatusUpdates publishes the updates left in the channel, followed by those still in the
+// status queue, and flushes the sink, giving up once ctx is done. Neither the queue nor the
+// publisher loop may still be running.
+func (m *workspaceManager) drainStatusUpdates(ctx context.Context, updates <-chan models.WorkspaceStatus) {
+	// Nothing else reads from or writes to the channel at this point
+	for len(updates) > 0 {
+		m.publishStatus(ctx, <-updates)
+	}
+
+	for _, statusUpdate := range m.statusQueue.Drain() {
+		m.publishStatus(ctx, statusUpdate)
+	}
+
+	if err := m.status.Flush(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush workspace-status sink")
+	}
+}
+
+// publishStatus sends a single status update to the workspace-status topic. An update that fails
+// to send is put back on the status queue to be retried, unless a newer one for the workspace is
+// already waiting.
+func (m *workspaceManager) publishStatus(ctx context.Context, statusUpdate models.WorkspaceStatus) error {
+	// Serialize the status update to JSON
+	payload, err := json.Marshal(statusUpdate)
+	if err != nil {
+		metrics.StatusUpdatesFailed.Inc()
+		log.Error().Err(err).Msg("Failed to serialize status update")
+		return err
+	}
+
+	// Publish the message to the workspace-status topic
+	err = m.status.Send(ctx, &transport.OutgoingMessage{
+		Key:     statusUpdate.Name,
+		Payload: payload,
+	})
+	if err != nil {
+		metrics.StatusUpdatesFailed.Inc()
+		m.components.MarkFailed(health.StatusProducer, err)
+		log.Error().Err(err).Str("workspace", statusUpdate.Name).Msg("Failed to publish status update; requeueing it")
+		m.statusQueue.Requeue(statusUpdate)
+		return err
+	}
+
+	metrics.StatusUpdatesPublished.Inc()
+	m.components.MarkHealthy(health.StatusProducer)
+	log.Info().Msgf("Published status update: %v", statusUpdate)
+	return nil
+}
+
+// waitWithContext waits for wait to return, giving up once ctx is done. It reports whether wait
+// returned.
+func waitWithContext(ctx context.Context, wait func()) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
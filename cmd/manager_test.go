@@ -0,0 +1,532 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/health"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s/k8stest"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/messaging"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/transport"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// testConfig returns a configuration for the in-memory transport that retries quickly
+func testConfig() *utils.Config {
+	return &utils.Config{
+		Transport:         utils.TransportMemory,
+		ShutdownTimeout:   time.Second,
+		StatusChannelSize: 10,
+		MaxInFlight:       10,
+		Pulsar: utils.PulsarConfig{
+			Retry: utils.RetryConfig{MaxRedeliveries: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		},
+		AWS:        utils.AWSConfig{Cluster: "cluster", FSID: "fs-12345", Bucket: "bucket"},
+		Storage:    utils.StorageConfig{Size: "10Gi", StorageClass: "file-storage", Driver: "efs.csi.aws.com"},
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+	}
+}
+
+// newTestManager returns a workspaceManager connected to an in-memory bus and the given client
+func newTestManager(t *testing.T, k8sClient client.Client, c *utils.Config) (*workspaceManager, *transport.MemoryBus) {
+	bus := transport.NewMemoryBus()
+	broker := bus.Transport(messaging.ExponentialBackoff{Initial: time.Millisecond, Max: time.Millisecond})
+	t.Cleanup(broker.Close)
+
+	return &workspaceManager{
+		configs:     utils.NewConfigStore("", nil, c),
+		k8sClient:   k8sClient,
+		settings:    broker.Settings,
+		status:      broker.Status,
+		deadLetters: messaging.NewDeadLetterQueue(broker.DeadLetter),
+		serializer:  messaging.NewKeySerializer(),
+		statusQueue: k8s.NewStatusQueue(),
+		components:  health.NewComponents(health.StatusProducer, health.SettingsConsumer, health.ConsumerLoop),
+		inFlight:    make(chan struct{}, c.MaxInFlight),
+	}, bus
+}
+
+// sendSettings publishes a workspace-settings message to the in-memory bus
+func sendSettings(t *testing.T, bus *transport.MemoryBus, payload models.WorkspaceSettings, properties map[string]string) {
+	data, err := json.Marshal(payload)
+	assert.NoError(t, err)
+	err = bus.Sink(transport.MemoryTopicSettings).Send(context.Background(), &transport.OutgoingMessage{
+		Key:        payload.Name,
+		Payload:    data,
+		Properties: properties,
+	})
+	assert.NoError(t, err)
+}
+
+// operationLog records the writes made to the fake cluster
+type operationLog struct {
+	mu  sync.Mutex
+	ops []string
+}
+
+func (l *operationLog) add(op string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ops = append(l.ops, op)
+}
+
+func (l *operationLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.ops...)
+}
+
+func TestFailedMessageHoldsBackLaterMessagesForWorkspace(t *testing.T) {
+	scheme, err := k8s.NewScheme()
+	assert.NoError(t, err)
+
+	// The first apply fails, so the create has to be retried
+	var ops operationLog
+	failed := false
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if !failed {
+				failed = true
+				ops.add("apply-failed")
+				return errors.New("apiserver unavailable")
+			}
+			ops.add("apply")
+			return k8stest.ServerSideApply(ctx, c, obj, patch, opts...)
+		},
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			ops.add("delete")
+			return c.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+
+	m, bus := newTestManager(t, k8sClient, testConfig())
+	sendSettings(t, bus, models.WorkspaceSettings{Name: "demo", Status: "creating"}, nil)
+	sendSettings(t, bus, models.WorkspaceSettings{Name: "demo", Status: "deleting"}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.consumeSettings(ctx, context.Background())
+	}()
+	assert.Eventually(t, func() bool { return len(ops.get()) == 3 }, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+	m.serializer.Wait()
+
+	// The delete waits for the create to succeed, so the workspace stays deleted
+	assert.Equal(t, []string{"apply-failed", "apply", "delete"}, ops.get())
+	err = k8sClient.Get(context.Background(), client.ObjectKey{Name: "demo", Namespace: "workspaces"}, &v1alpha1.Workspace{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestFailedMessageIsDeadLettered(t *testing.T) {
+	scheme, err := k8s.NewScheme()
+	assert.NoError(t, err)
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			return errors.New("apiserver unavailable")
+		},
+	}).Build()
+
+	m, bus := newTestManager(t, k8sClient, testConfig())
+	sendSettings(t, bus, models.WorkspaceSettings{Name: "demo", Status: "creating"}, nil)
+	msg, err := m.settings.Receive(context.Background())
+	assert.NoError(t, err)
+
+	m.handleSettings(context.Background(), msg, models.Envelope{}, models.WorkspaceSettings{Name: "demo", Status: "creating"})
+
+	// Once the retries are used up the message is dead-lettered
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	dead, err := bus.Source(transport.MemoryTopicDeadLetter, messaging.ExponentialBackoff{}).Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, messaging.ReasonRetriesExhausted, dead.Properties()[messaging.PropertyReason])
+	assert.Contains(t, dead.Properties()[messaging.PropertyError], "apiserver unavailable")
+}
+
+// failingSink is a StatusSink whose sends fail while err is set
+type failingSink struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (s *failingSink) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *failingSink) Send(context.Context, *transport.OutgoingMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *failingSink) Flush(context.Context) error { return nil }
+func (s *failingSink) Close()                      {}
+
+func TestPublishStatusTracksProducerHealth(t *testing.T) {
+	m, _ := newTestManager(t, nil, testConfig())
+	sink := &failingSink{}
+	m.status = sink
+
+	sink.fail(errors.New("producer disconnected"))
+	assert.Error(t, m.publishStatus(context.Background(), models.WorkspaceStatus{Name: "demo"}))
+	assert.ErrorContains(t, m.components.Check(health.StatusProducer), "producer disconnected")
+
+	sink.fail(nil)
+	assert.NoError(t, m.publishStatus(context.Background(), models.WorkspaceStatus{Name: "other"}))
+	assert.NoError(t, m.components.Check(health.StatusProducer))
+}
+
+func TestFailedStatusUpdateIsRequeued(t *testing.T) {
+	m, _ := newTestManager(t, nil, testConfig())
+	sink := &failingSink{err: errors.New("producer disconnected")}
+	m.status = sink
+
+	assert.Error(t, m.publishStatus(context.Background(), models.WorkspaceStatus{Name: "a", State: "Pending"}))
+	assert.Equal(t, []models.WorkspaceStatus{{Name: "a", State: "Pending"}}, m.statusQueue.Drain())
+
+	// A newer update queued while the failed one was being sent wins
+	m.statusQueue.Push(models.WorkspaceStatus{Name: "a", State: "Ready"})
+	assert.Error(t, m.publishStatus(context.Background(), models.WorkspaceStatus{Name: "a", State: "Pending"}))
+	assert.Equal(t, []models.WorkspaceStatus{{Name: "a", State: "Ready"}}, m.statusQueue.Drain())
+}
+
+func TestConsumeSettingsTracksConsumerHealth(t *testing.T) {
+	m, _ := newTestManager(t, nil, testConfig())
+	m.components.MarkHealthy(health.SettingsConsumer)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.consumeSettings(context.Background(), context.Background())
+	}()
+
+	// Closing the source stops the loop and marks both failed
+	assert.Eventually(t, func() bool { return m.components.Check(health.ConsumerLoop) == nil }, 5*time.Second, time.Millisecond)
+	m.settings.Close()
+	<-done
+	m.serializer.Wait()
+	assert.ErrorIs(t, m.components.Check(health.SettingsConsumer), transport.ErrClosed)
+	assert.ErrorIs(t, m.components.Check(health.ConsumerLoop), transport.ErrClosed)
+}
+
+// pingSource is a SettingsSource whose connection checks fail while err is set
+type pingSource struct {
+	transport.SettingsSource
+	mu  sync.Mutex
+	err error
+}
+
+func (s *pingSource) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *pingSource) Ping(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func TestMonitorSettingsConsumer(t *testing.T) {
+	m, _ := newTestManager(t, nil, testConfig())
+	source := &pingSource{SettingsSource: m.settings}
+	m.settings = source
+	m.components.MarkHealthy(health.SettingsConsumer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.monitorSettingsConsumer(ctx, time.Millisecond)
+	}()
+
+	// The consumer is unready while it cannot reach the broker, although Receive has not failed
+	source.fail(errors.New("connection closed"))
+	assert.Eventually(t, func() bool { return m.components.Check(health.SettingsConsumer) != nil }, time.Second, time.Millisecond)
+	assert.ErrorContains(t, m.components.Check(health.SettingsConsumer), "connection closed")
+
+	source.fail(nil)
+	assert.Eventually(t, func() bool { return m.components.Check(health.SettingsConsumer) == nil }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestDrainStatusUpdates(t *testing.T) {
+	m, bus := newTestManager(t, nil, testConfig())
+	updates := make(chan models.WorkspaceStatus, 1)
+	updates <- models.WorkspaceStatus{Name: "buffered"}
+	m.statusQueue.Push(models.WorkspaceStatus{Name: "queued"})
+
+	m.drainStatusUpdates(context.Background(), updates)
+
+	// Updates in the channel are published before those still queued
+	status := bus.Source(transport.MemoryTopicStatus, messaging.ExponentialBackoff{})
+	for _, name := range []string{"buffered", "queued"} {
+		msg, err := status.Receive(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, name, msg.Key())
+	}
+	assert.Zero(t, m.statusQueue.Len())
+}
+
+// blockingSink is a StatusSink whose sends wait until their context is done, like a producer
+// whose broker is down
+type blockingSink struct{}
+
+func (blockingSink) Send(ctx context.Context, _ *transport.OutgoingMessage) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (blockingSink) Flush(context.Context) error { return nil }
+func (blockingSink) Close()                      {}
+
+func TestPublishStatusUpdatesStopsDuringSend(t *testing.T) {
+	m, _ := newTestManager(t, nil, testConfig())
+	m.status = blockingSink{}
+	updates := make(chan models.WorkspaceStatus, 1)
+	updates <- models.WorkspaceStatus{Name: "demo"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.publishStatusUpdates(ctx, updates)
+	}()
+	assert.Eventually(t, func() bool { return len(updates) == 0 }, time.Second, time.Millisecond)
+
+	// Stopping the publisher abandons the send, leaving the update queued for the drain
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publisher did not stop while a send was in progress")
+	}
+	assert.Equal(t, []models.WorkspaceStatus{{Name: "demo"}}, m.statusQueue.Drain())
+}
+
+func TestWaitWithContext(t *testing.T) {
+	assert.True(t, waitWithContext(context.Background(), func() {}))
+
+	// The deadline is shared, so once it has passed nothing more is waited for
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+	assert.False(t, waitWithContext(ctx, func() { <-block }))
+	assert.False(t, waitWithContext(ctx, func() { <-block }))
+}
+
+// runConsumer runs consumeSettings until the returned function is called, which stops it and waits
+// for the messages it received to be handled
+func runConsumer(m *workspaceManager) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.consumeSettings(ctx, context.Background())
+	}()
+	return func() {
+		cancel()
+		<-done
+		m.serializer.Wait()
+	}
+}
+
+// assertNoMessage checks that nothing arrives on topic within a short wait
+func assertNoMessage(t *testing.T, bus *transport.MemoryBus, topic string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := bus.Source(topic, messaging.ExponentialBackoff{}).Receive(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestConsumeSettingsAppliesWorkspace(t *testing.T) {
+	scheme, err := k8s.NewScheme()
+	assert.NoError(t, err)
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{Patch: k8stest.ServerSideApply}).Build()
+
+	m, bus := newTestManager(t, k8sClient, testConfig())
+	sendSettings(t, bus, models.WorkspaceSettings{Name: "demo", Status: "creating"}, nil)
+
+	stop := runConsumer(m)
+	assert.Eventually(t, func() bool {
+		return k8sClient.Get(context.Background(), client.ObjectKey{Name: "demo", Namespace: "workspaces"}, &v1alpha1.Workspace{}) == nil
+	}, 5*time.Second, time.Millisecond)
+	stop()
+
+	// The message is acknowledged rather than dead-lettered or redelivered
+	assertNoMessage(t, bus, transport.MemoryTopicDeadLetter)
+	assertNoMessage(t, bus, transport.MemoryTopicSettings)
+}
+
+func TestConsumeSettingsDeadLettersMalformedMessage(t *testing.T) {
+	m, bus := newTestManager(t, nil, testConfig())
+	err := bus.Sink(transport.MemoryTopicSettings).Send(context.Background(), &transport.OutgoingMessage{Key: "demo", Payload: []byte("not json")})
+	assert.NoError(t, err)
+
+	stop := runConsumer(m)
+	defer stop()
+
+	// A message that cannot be decoded is dead-lettered without any retries
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	dead, err := bus.Source(transport.MemoryTopicDeadLetter, messaging.ExponentialBackoff{}).Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, messaging.ReasonMalformedPayload, dead.Properties()[messaging.PropertyReason])
+	assert.Equal(t, "not json", string(dead.Payload()))
+}
+
+func TestDryRunMessageLeavesClusterUntouched(t *testing.T) {
+	scheme, err := k8s.NewScheme()
+	assert.NoError(t, err)
+	var ops operationLog
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			ops.add("apply")
+			return k8stest.ServerSideApply(ctx, c, obj, patch, opts...)
+		},
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			ops.add("delete")
+			return c.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+
+	m, bus := newTestManager(t, k8sClient, testConfig())
+	sendSettings(t, bus, models.WorkspaceSettings{Name: "demo", Status: "creating"}, map[string]string{dryRunProperty: "true"})
+	msg, err := m.settings.Receive(context.Background())
+	assert.NoError(t, err)
+
+	m.handleSettings(context.Background(), msg, models.Envelope{}, models.WorkspaceSettings{Name: "demo", Status: "creating"})
+
+	// The message is settled without anything being written
+	assert.Empty(t, ops.get())
+	err = k8sClient.Get(context.Background(), client.ObjectKey{Name: "demo", Namespace: "workspaces"}, &v1alpha1.Workspace{})
+	assert.True(t, apierrors.IsNotFound(err))
+	assertNoMessage(t, bus, transport.MemoryTopicDeadLetter)
+}
+
+func TestShutdownNacksAbandonedMessage(t *testing.T) {
+	scheme, err := k8s.NewScheme()
+	assert.NoError(t, err)
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			return errors.New("apiserver unavailable")
+		},
+	}).Build()
+
+	// The retries would outlast the shutdown deadline
+	c := testConfig()
+	c.Pulsar.Retry = utils.RetryConfig{MaxRedeliveries: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	m, bus := newTestManager(t, k8sClient, c)
+	sendSettings(t, bus, models.WorkspaceSettings{Name: "demo", Status: "creating"}, nil)
+	msg, err := m.settings.Receive(context.Background())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	m.handleSettings(ctx, msg, models.Envelope{}, models.WorkspaceSettings{Name: "demo", Status: "creating"})
+
+	// Work abandoned at the deadline is redelivered rather than dead-lettered
+	receiveCtx, receiveCancel := context.WithTimeout(context.Background(), time.Second)
+	defer receiveCancel()
+	redelivered, err := m.settings.Receive(receiveCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, msg.ID(), redelivered.ID())
+	assert.Equal(t, uint32(1), redelivered.RedeliveryCount())
+	assertNoMessage(t, bus, transport.MemoryTopicDeadLetter)
+}
+
+func TestConsumeSettingsLimitsMessagesInFlight(t *testing.T) {
+	scheme, err := k8s.NewScheme()
+	assert.NoError(t, err)
+
+	// Applies wait until released, so messages stay in flight
+	release := make(chan struct{})
+	var mu sync.Mutex
+	applying, maxApplying := 0, 0
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			mu.Lock()
+			applying++
+			maxApplying = max(maxApplying, applying)
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			applying--
+			mu.Unlock()
+			return k8stest.ServerSideApply(ctx, c, obj, patch, opts...)
+		},
+	}).Build()
+
+	c := testConfig()
+	c.MaxInFlight = 2
+	m, bus := newTestManager(t, k8sClient, c)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		sendSettings(t, bus, models.WorkspaceSettings{Name: name, Status: "creating"}, nil)
+	}
+
+	stop := runConsumer(m)
+
+	// No more messages are received than there are slots, even for different workspaces
+	assert.Eventually(t, func() bool { return len(m.inFlight) == 2 }, 5*time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, 2, applying)
+	mu.Unlock()
+
+	// Settling messages frees their slots for the rest
+	close(release)
+	var workspaces v1alpha1.WorkspaceList
+	assert.Eventually(t, func() bool {
+		return k8sClient.List(context.Background(), &workspaces) == nil && len(workspaces.Items) == 4
+	}, 5*time.Second, time.Millisecond)
+	stop()
+	assert.Equal(t, 2, maxApplying)
+	assert.Zero(t, len(m.inFlight))
+}
+
+func TestInvalidSettingsAreDeadLetteredWithoutRetries(t *testing.T) {
+	scheme, err := k8s.NewScheme()
+	assert.NoError(t, err)
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{Patch: k8stest.ServerSideApply}).Build()
+
+	// Retrying would hold back the workspace's later messages for an hour
+	c := testConfig()
+	c.Pulsar.Retry = utils.RetryConfig{MaxRedeliveries: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	m, bus := newTestManager(t, k8sClient, c)
+	sendSettings(t, bus, models.WorkspaceSettings{Name: "demo", Status: "archived"}, nil)
+	sendSettings(t, bus, models.WorkspaceSettings{Name: "demo", Status: "creating"}, nil)
+
+	stop := runConsumer(m)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	dead, err := bus.Source(transport.MemoryTopicDeadLetter, messaging.ExponentialBackoff{}).Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, messaging.ReasonInvalidSettings, dead.Properties()[messaging.PropertyReason])
+	assert.Contains(t, dead.Properties()[messaging.PropertyError], "unknown status: archived")
+
+	// The next message for the workspace is not held back
+	assert.Eventually(t, func() bool {
+		return k8sClient.Get(context.Background(), client.ObjectKey{Name: "demo", Namespace: "workspaces"}, &v1alpha1.Workspace{}) == nil
+	}, time.Second, time.Millisecond)
+}
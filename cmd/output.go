@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	workspacev1alpha1 "github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats for the admin commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// workspaceRow is the summary of a Workspace printed in a table by the admin commands
+type workspaceRow struct {
+	Name      string
+	State     string
+	Namespace string
+	Role      string
+}
+
+// printWorkspace writes a single Workspace, as a summary table or as the full CR in JSON or YAML
+func printWorkspace(w io.Writer, format string, workspace workspacev1alpha1.Workspace) error {
+	workspace.TypeMeta = workspaceTypeMeta("Workspace")
+	return printWorkspaces(w, format, []workspaceRow{newWorkspaceRow(workspace)}, workspace)
+}
+
+// printWorkspaceList writes every Workspace, as a summary table or as a WorkspaceList in JSON or
+// YAML
+func printWorkspaceList(w io.Writer, format string, workspaces []workspacev1alpha1.Workspace) error {
+	list := workspacev1alpha1.WorkspaceList{TypeMeta: workspaceTypeMeta("WorkspaceList")}
+	rows := make([]workspaceRow, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		workspace.TypeMeta = workspaceTypeMeta("Workspace")
+		list.Items = append(list.Items, workspace)
+		rows = append(rows, newWorkspaceRow(workspace))
+	}
+	return printWorkspaces(w, format, rows, list)
+}
+
+// workspaceTypeMeta returns the type information of a Workspace kind, which is not set on objects
+// read with a typed client
+func workspaceTypeMeta(kind string) metav1.TypeMeta {
+	return metav1.TypeMeta{APIVersion: workspacev1alpha1.GroupVersion.String(), Kind: kind}
+}
+
+// printWorkspaces writes rows as a table, or obj as JSON or YAML
+func printWorkspaces(w io.Writer, format string, rows []workspaceRow, obj any) error {
+	switch format {
+	case outputJSON:
+		out, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case outputYAML:
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(w, string(out))
+		return err
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSTATE\tNAMESPACE\tROLE")
+		for _, row := range rows {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", row.Name, row.State, row.Namespace, row.Role)
+		}
+		return tw.Flush()
+	}
+}
+
+// newWorkspaceRow summarises a Workspace, preferring the observed role and namespace over the
+// requested ones
+func newWorkspaceRow(workspace workspacev1alpha1.Workspace) workspaceRow {
+	namespace := workspace.Status.Namespace
+	if namespace == "" {
+		namespace = workspace.Spec.Namespace
+	}
+	role := workspace.Status.AWS.Role.Name
+	if role == "" {
+		role = workspace.Spec.AWS.RoleName
+	}
+
+	return workspaceRow{
+		Name:      workspace.Name,
+		State:     workspace.Status.State,
+		Namespace: namespace,
+		Role:      role,
+	}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	workspacev1alpha1 "github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func testWorkspace() workspacev1alpha1.Workspace {
+	return workspacev1alpha1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "workspaces"},
+		Spec:       workspacev1alpha1.WorkspaceSpec{Namespace: "ws-demo", AWS: workspacev1alpha1.AWSSpec{RoleName: "cluster-demo"}},
+		Status:     workspacev1alpha1.WorkspaceStatus{State: "Ready", ErrorDescription: "none"},
+	}
+}
+
+func TestPrintWorkspaceTable(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, printWorkspace(&out, outputTable, testWorkspace()))
+	assert.Contains(t, out.String(), "NAME")
+	assert.Contains(t, out.String(), "demo")
+	assert.Contains(t, out.String(), "cluster-demo")
+}
+
+func TestPrintWorkspaceFullCR(t *testing.T) {
+	// JSON and YAML print the whole CR rather than the table columns
+	var out bytes.Buffer
+	assert.NoError(t, printWorkspace(&out, outputJSON, testWorkspace()))
+	var printed workspacev1alpha1.Workspace
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &printed))
+	assert.Equal(t, "Workspace", printed.Kind)
+	assert.Equal(t, "ws-demo", printed.Spec.Namespace)
+	assert.Equal(t, "none", printed.Status.ErrorDescription)
+
+	out.Reset()
+	assert.NoError(t, printWorkspaceList(&out, outputYAML, []workspacev1alpha1.Workspace{testWorkspace()}))
+	var list workspacev1alpha1.WorkspaceList
+	assert.NoError(t, yaml.Unmarshal(out.Bytes(), &list))
+	assert.Equal(t, "WorkspaceList", list.Kind)
+	if assert.Len(t, list.Items, 1) {
+		assert.Equal(t, "Workspace", list.Items[0].Kind)
+		assert.Equal(t, "cluster-demo", list.Items[0].Spec.AWS.RoleName)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/messaging"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	renderID  int64
+	renderCmd = &cobra.Command{
+		Use:   "render <settings.json>",
+		Short: "Print the Workspace CR for a settings file",
+		Long: "Print the Workspace CR YAML that the manager would write for a WorkspaceSettings JSON file " +
+			"under the given configuration. No cluster access is needed.",
+		Args: cobra.ExactArgs(1),
+		Run:  runRender,
+	}
+)
+
+func init() {
+	renderCmd.Flags().Int64Var(&renderID, "id", 1000, "POSIX UID and GID to render the EFS access points with")
+	rootCmd.AddCommand(renderCmd)
+}
+
+// runRender prints the Workspace built from a settings file
+func runRender(cmd *cobra.Command, args []string) {
+	appConfig := loadConfig(cmd)
+	utils.InitLogger(appConfig.LogLevel)
+
+	payload, err := readSettingsFile(args[0])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read workspace settings")
+	}
+
+	workspace, err := k8s.BuildWorkspace(payload, appConfig, k8s.PosixIdentity{UID: renderID, GID: renderID}, nil)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to build workspace")
+	}
+
+	out, err := yaml.Marshal(workspace)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to serialize workspace")
+	}
+	fmt.Fprint(cmd.OutOrStdout(), string(out))
+}
+
+// readSettingsFile reads a workspace-settings message from a JSON file, either enveloped or a bare
+// WorkspaceSettings object, as it would be decoded from the topic
+func readSettingsFile(path string) (models.WorkspaceSettings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return models.WorkspaceSettings{}, err
+	}
+	_, payload, err := messaging.DecodeSettings(data)
+	if err != nil {
+		return payload, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if payload.Name == "" {
+		return payload, fmt.Errorf("no workspace name in %s", path)
+	}
+	return payload, nil
+}
@@ -2,151 +2,263 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/health"
 	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/messaging"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/transport"
 	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
 	"github.com/EO-DataHub/eodhp-workspace-manager/models"
-	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"github.com/spf13/pflag"
 )
 
 var (
-	configFile string
-	rootCmd    = &cobra.Command{
-		Use:   "workspace-manager",
-		Short: "Workspace Manager CLI",
-		Long:  "A CLI to manage workspaces with Kubernetes and Pulsar integration.",
-		Run:   runWorkspaceManager,
+	configFile  string
+	printConfig bool
+	rootCmd     = &cobra.Command{
+		Use:              "workspace-manager",
+		Short:            "Workspace Manager CLI",
+		Long:             "A CLI to manage workspaces with Kubernetes and message broker integration.",
+		PersistentPreRun: runPrintConfig,
+		Run:              runWorkspaceManager,
 	}
 )
 
 // init initializes the root command
 func init() {
 	rootCmd.PersistentFlags().StringVar(&configFile, "config", "config.yaml", "Path to configuration file")
+	rootCmd.PersistentFlags().BoolVar(&printConfig, "print-config", false, "Print the effective configuration with secrets masked and exit")
+
+	// Every setting can be overridden on the command line
+	for _, setting := range utils.Settings() {
+		addSettingFlag(rootCmd.PersistentFlags(), setting)
+	}
+}
+
+// addSettingFlag registers the flag overriding a setting, typed like the setting so that, for
+// example, --dry-run needs no value. The default shown in the usage is the built-in default, which
+// the config file and environment may have replaced.
+func addSettingFlag(flags *pflag.FlagSet, setting utils.Setting) {
+	usage := fmt.Sprintf("Override %s (environment variable %s)", setting.Key, setting.EnvVar)
+	switch value := setting.Default.(type) {
+	case bool:
+		flags.Bool(setting.Flag, value, usage)
+	case int:
+		flags.Int(setting.Flag, value, usage)
+	case int64:
+		flags.Int64(setting.Flag, value, usage)
+	case uint32:
+		flags.Uint32(setting.Flag, value, usage)
+	case time.Duration:
+		flags.Duration(setting.Flag, value, usage)
+	case string:
+		if setting.Secret {
+			value = ""
+		}
+		flags.String(setting.Flag, value, usage)
+	default:
+		panic(fmt.Sprintf("setting %s has unsupported type %T", setting.Key, setting.Default))
+	}
+}
+
+// configOverrides returns the settings given on the command line, keyed by setting key
+func configOverrides(cmd *cobra.Command) map[string]string {
+	overrides := make(map[string]string)
+	for _, setting := range utils.Settings() {
+		if flag := cmd.Flags().Lookup(setting.Flag); flag != nil && flag.Changed {
+			overrides[setting.Key] = flag.Value.String()
+		}
+	}
+	return overrides
+}
+
+// loadConfig loads the configuration from the file, environment and command line
+func loadConfig(cmd *cobra.Command) *utils.Config {
+	return utils.LoadConfig(configFile, configOverrides(cmd))
+}
+
+// runPrintConfig prints the effective configuration and exits if --print-config is set
+func runPrintConfig(cmd *cobra.Command, args []string) {
+	if !printConfig {
+		return
+	}
+	if err := utils.PrintConfig(cmd.OutOrStdout(), configFile, configOverrides(cmd)); err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s is invalid:\n%v\n", configFile, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
 }
 
 func Execute() {
 	// Execute the root command
-	if err := rootCmd.Execute(); err != nil {
-		log.Fatal().Err(err).Msg("Failed to execute command")
+	cmd, err := rootCmd.ExecuteC()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to execute command")
+		// Usage errors from diff must not look like differences
+		if cmd == diffCmd {
+			os.Exit(diffExitError)
+		}
+		os.Exit(1)
 	}
 }
 
 // runWorkspaceManager is the main entry point for the Workspace Manager
 func runWorkspaceManager(cmd *cobra.Command, args []string) {
 	// Load configuration
-	appConfig := utils.LoadConfig(configFile)
+	appConfig := loadConfig(cmd)
 
 	// Initialize logger
 	utils.InitLogger(appConfig.LogLevel)
 	log.Info().Msg("Workspace Manager starting...")
 
-	// Initialize Pulsar client
-	pulsarClient, err := pulsar.NewClient(pulsar.ClientOptions{URL: appConfig.Pulsar.URL, MaxConnectionsPerBroker: 1})
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create Pulsar Client")
-	}
-	defer pulsarClient.Close()
+	// Root context for the whole process, cancelled on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Producer for workspace-status topic
-	statusProducer, err := pulsarClient.CreateProducer(pulsar.ProducerOptions{
-		Topic: appConfig.Pulsar.TopicProducer,
-	})
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create Pulsar producer for workspace-status")
-	}
-	defer statusProducer.Close()
+	// Track the health of the broker connection and consumer loop for the probe endpoints
+	components := health.NewComponents(health.StatusProducer, health.SettingsConsumer, health.ConsumerLoop)
 
-	// Consumer for workspace-settings topic
-	settingsConsumer, err := pulsarClient.Subscribe(pulsar.ConsumerOptions{
-		Topic:            appConfig.Pulsar.TopicConsumer,
-		SubscriptionName: appConfig.Pulsar.Subscription,
-		Type:             pulsar.Shared,
+	// Connect to the message broker. Nacked settings messages are redelivered with exponential backoff
+	retry := appConfig.Retry()
+	broker, err := transport.Open(ctx, appConfig, messaging.ExponentialBackoff{
+		Initial: retry.InitialBackoff,
+		Max:     retry.MaxBackoff,
 	})
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create Pulsar consumer for workspace-settings")
+		log.Fatal().Err(err).Str("transport", appConfig.Transport).Msg("Failed to connect to the message broker")
 	}
-	defer settingsConsumer.Close()
+	defer broker.Close()
+	if appConfig.Transport == utils.TransportMemory {
+		log.Warn().Msg("The memory transport keeps messages in the process, so no workspace-settings messages will be received")
+	}
+
+	// The broker is connected, so both are healthy until a send or connection check fails
+	components.MarkHealthy(health.StatusProducer)
+	components.MarkHealthy(health.SettingsConsumer)
 
 	// Initialize Kubernetes manager
-	k8sMgr, err := k8s.InitializeManager()
+	k8sMgr, err := k8s.InitializeManager(appConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize Kubernetes manager")
 	}
 
-	// Start the Kubernetes manager
+	// The manager is only live while the consumer loop is running, and only ready once the
+	// broker connection is up as well
+	if err := k8sMgr.AddHealthzCheck(health.ConsumerLoop, components.Checker(health.ConsumerLoop)); err != nil {
+		log.Fatal().Err(err).Msg("Failed to add liveness check")
+	}
+	for _, name := range []string{health.StatusProducer, health.SettingsConsumer, health.ConsumerLoop} {
+		if err := k8sMgr.AddReadyzCheck(name, components.Checker(name)); err != nil {
+			log.Fatal().Err(err).Msg("Failed to add readiness check")
+		}
+	}
+
+	m := &workspaceManager{
+		configs:     utils.NewConfigStore(configFile, configOverrides(cmd), appConfig),
+		k8sClient:   k8s.NewManagerClient(k8sMgr),
+		settings:    broker.Settings,
+		status:      broker.Status,
+		deadLetters: messaging.NewDeadLetterQueue(broker.DeadLetter),
+		serializer:  messaging.NewKeySerializer(),
+		statusQueue: k8s.NewStatusQueue(),
+		components:  components,
+		inFlight:    make(chan struct{}, appConfig.MaxInFlight),
+	}
+	metrics.RegisterInFlight(func() int { return len(m.inFlight) })
+
+	// The manager runs on its own context so that its client and informers keep working while
+	// in-flight messages are drained during shutdown
+	mgrCtx, stopMgr := context.WithCancel(context.Background())
+	defer stopMgr()
+	mgrDone := make(chan struct{})
 	go func() {
-		if err := k8sMgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		defer close(mgrDone)
+		if err := k8sMgr.Start(mgrCtx); err != nil {
 			log.Fatal().Err(err).Msg("Failed to start Kubernetes manager")
 		}
 	}()
 
-	// Listen for updates to workspace CR status and send updates to workspace-status topic
-	chanWorkspaceStatus := make(chan models.WorkspaceStatus, 100)
-	if err := k8s.ListenForWorkspaceStatusUpdates(context.Background(), k8sMgr, chanWorkspaceStatus); err != nil {
+	// Listen for updates to workspace CR status and queue them for the workspace-status topic
+	if err := k8s.ListenForWorkspaceStatusUpdates(mgrCtx, k8sMgr, m.statusQueue); err != nil {
 		log.Fatal().Err(err).Msg("Failed to start informer")
 	}
 
+	// Forward queued status updates to the producer loop, waiting whenever the channel is full
+	chanWorkspaceStatus := make(chan models.WorkspaceStatus, appConfig.StatusChannelSize)
+	metrics.RegisterStatusChannel(func() int { return len(chanWorkspaceStatus) })
+	metrics.RegisterStatusQueue(m.statusQueue.Len)
+	forwardCtx, stopForwarding := context.WithCancel(context.Background())
+	defer stopForwarding()
+	forwarderDone := make(chan struct{})
+	go func() {
+		defer close(forwarderDone)
+		m.statusQueue.Forward(forwardCtx, chanWorkspaceStatus)
+	}()
+
 	// Start the producer loop to process workspace-status messages
+	publishCtx, stopPublishing := context.WithCancel(context.Background())
+	defer stopPublishing()
+	publisherDone := make(chan struct{})
 	go func() {
-		for statusUpdate := range chanWorkspaceStatus {
-			// Serialize the status update to JSON
-			payload, err := json.Marshal(statusUpdate)
-			if err != nil {
-				log.Error().Err(err).Msg("Failed to serialize status update")
-				continue
-			}
-
-			// Publish the message to Pulsar
-			_, err = statusProducer.Send(context.Background(), &pulsar.ProducerMessage{
-				Payload: payload,
-			})
-			if err != nil {
-				log.Error().Err(err).Msg("Failed to publish status update to Pulsar")
-			} else {
-				log.Info().Msgf("Published status update to Pulsar: %v", statusUpdate)
-			}
+		defer close(publisherDone)
+		m.publishStatusUpdates(publishCtx, chanWorkspaceStatus)
+	}()
+
+	// Reload the configuration when the file changes, applying it to messages received afterwards
+	go func() {
+		err := m.configs.Watch(ctx, func(c *utils.Config) {
+			utils.InitLogger(c.LogLevel)
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Configuration will not be reloaded")
 		}
 	}()
 
+	// Check the consumer's broker connection for the readiness probe
+	go m.monitorSettingsConsumer(ctx, connectionCheckInterval)
+
 	// Start the consumer loop to process workspace-settings messages
+	workCtx, abandonWork := context.WithCancel(context.Background())
+	defer abandonWork()
+	consumerDone := make(chan struct{})
 	go func() {
-		for {
-			msg, err := settingsConsumer.Receive(context.Background())
-			if err != nil {
-				log.Error().Err(err).Msg("Error receiving message from Pulsar")
-				panic(err)
-			}
-
-			// Parse the message into WorkspaceSettings
-			var payload models.WorkspaceSettings
-			if err := json.Unmarshal(msg.Payload(), &payload); err != nil {
-				log.Error().Err(err).Msg("Failed to unmarshal workspace-settings message")
-				settingsConsumer.Nack(msg)
-				continue
-			}
-
-			// Process the workspace settings message
-			if err := k8s.ProcessWorkspace(context.Background(), k8sMgr.GetClient(), appConfig, payload); err != nil {
-				log.Error().Err(err).Msg("Failed to process workspace settings message")
-				settingsConsumer.Nack(msg)
-			} else {
-				settingsConsumer.Ack(msg)
-				log.Info().Msg("Message successfully processed and acknowledged")
-			}
-
-		}
+		defer close(consumerDone)
+		m.consumeSettings(ctx, workCtx)
 	}()
 
-	// Handle graceful shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
+	// Wait for a shutdown signal
+	<-ctx.Done()
 	log.Info().Msg("Shutting down Workspace Manager...")
+
+	// In-flight messages and buffered status updates share a single deadline
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), appConfig.ShutdownTimeout)
+	defer cancelShutdown()
+
+	// Stop receiving, then give in-flight messages until the deadline to finish
+	<-consumerDone
+	if !waitWithContext(shutdownCtx, m.serializer.Wait) {
+		log.Warn().Dur("timeout", appConfig.ShutdownTimeout).Msg("Timed out waiting for in-flight messages; abandoning them")
+		abandonWork()
+		m.serializer.Wait()
+	}
+
+	// Stop the informers so no new status updates arrive, then publish those already buffered in
+	// whatever time is left
+	stopMgr()
+	<-mgrDone
+	stopForwarding()
+	<-forwarderDone
+	stopPublishing()
+	<-publisherDone
+	m.drainStatusUpdates(shutdownCtx, chanWorkspaceStatus)
+
+	log.Info().Msg("Workspace Manager stopped")
 }
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingFlags(t *testing.T) {
+	cmd := &cobra.Command{Run: func(*cobra.Command, []string) {}}
+	for _, setting := range utils.Settings() {
+		addSettingFlag(cmd.Flags(), setting)
+	}
+
+	// Flags are typed like their settings, so bools need no value and the defaults are shown
+	assert.Equal(t, "bool", cmd.Flags().Lookup("dry-run").Value.Type())
+	assert.Equal(t, "duration", cmd.Flags().Lookup("shutdown-timeout").Value.Type())
+	assert.Equal(t, "30s", cmd.Flags().Lookup("shutdown-timeout").DefValue)
+	assert.Equal(t, "uint32", cmd.Flags().Lookup("pulsar.retry.max-redeliveries").Value.Type())
+
+	err := cmd.ParseFlags([]string{"--dry-run", "--shutdown-timeout=1m", "--pulsar.retry.max-redeliveries=0", "--aws.bucket", "bucket"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"dryRun":                       "true",
+		"shutdownTimeout":              "1m0s",
+		"pulsar.retry.maxRedeliveries": "0",
+		"aws.bucket":                   "bucket",
+	}, configOverrides(cmd))
+
+	// The overrides parse back into the configuration
+	c := &utils.Config{}
+	for key, value := range configOverrides(cmd) {
+		assert.NoError(t, c.Set(key, value))
+	}
+	assert.True(t, c.DryRun)
+
+	assert.Error(t, cmd.ParseFlags([]string{"--max-in-flight=lots"}))
+}
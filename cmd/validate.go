@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var validateConfigCmd = &cobra.Command{
+	Use:   "validate-config",
+	Short: "Check a configuration file",
+	Long: "Load the configuration file given with --config, apply defaults and report every problem found. " +
+		"Exits with status 1 if the configuration is invalid.",
+	Args: cobra.NoArgs,
+	Run:  runValidateConfig,
+}
+
+func init() {
+	rootCmd.AddCommand(validateConfigCmd)
+}
+
+// runValidateConfig reports whether the configuration file is valid
+func runValidateConfig(cmd *cobra.Command, args []string) {
+	if _, err := utils.ReadConfig(configFile, configOverrides(cmd)); err != nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s is invalid:\n%v\n", configFile, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", configFile)
+}
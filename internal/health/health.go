@@ -0,0 +1,71 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// Names of the components tracked by the manager
+const (
+	StatusProducer   = "status-producer"
+	SettingsConsumer = "settings-consumer"
+	ConsumerLoop     = "consumer-loop"
+)
+
+var errNotStarted = errors.New("not started")
+
+// Components tracks the health of the long running parts of the manager that the
+// controller-runtime manager cannot observe itself, such as the broker connection
+type Components struct {
+	mu    sync.RWMutex
+	state map[string]error
+}
+
+// NewComponents creates a tracker in which every named component starts unhealthy
+func NewComponents(names ...string) *Components {
+	state := make(map[string]error, len(names))
+	for _, name := range names {
+		state[name] = errNotStarted
+	}
+	return &Components{state: state}
+}
+
+// MarkHealthy records that a component is running
+func (c *Components) MarkHealthy(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state[name] = nil
+}
+
+// MarkFailed records that a component has stopped or is failing
+func (c *Components) MarkFailed(name string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state[name] = err
+}
+
+// Check returns the last error recorded for a component, or nil if it is healthy
+func (c *Components) Check(name string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	err, ok := c.state[name]
+	if !ok {
+		return fmt.Errorf("%s: unknown component", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// Checker returns a healthz.Checker for a component
+func (c *Components) Checker(name string) healthz.Checker {
+	return func(_ *http.Request) error {
+		return c.Check(name)
+	}
+}
@@ -0,0 +1,24 @@
+package health
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComponents(t *testing.T) {
+	components := NewComponents(StatusProducer, ConsumerLoop)
+
+	// Components start unhealthy until they report in
+	assert.ErrorIs(t, components.Check(StatusProducer), errNotStarted)
+
+	components.MarkHealthy(StatusProducer)
+	assert.NoError(t, components.Checker(StatusProducer)(nil))
+
+	components.MarkHealthy(ConsumerLoop)
+	components.MarkFailed(ConsumerLoop, errors.New("consumer closed"))
+	assert.EqualError(t, components.Check(ConsumerLoop), "consumer-loop: consumer closed")
+
+	assert.Error(t, components.Check("unknown"))
+}
@@ -0,0 +1,67 @@
+package k8s
+
+import (
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/rs/zerolog/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// Error classes reported in logs and metrics for failed Workspace operations
+const (
+	ErrorClassConflict      = "conflict"
+	ErrorClassFieldConflict = "field_conflict"
+	ErrorClassNotFound      = "not_found"
+	ErrorClassPermanent     = "permanent"
+	ErrorClassOther         = "other"
+)
+
+// ErrorClass categorises an error returned by a Workspace operation
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case IsPermanent(err):
+		return ErrorClassPermanent
+	case isFieldManagerConflict(err):
+		return ErrorClassFieldConflict
+	case apierrors.IsConflict(err):
+		return ErrorClassConflict
+	case apierrors.IsNotFound(err):
+		return ErrorClassNotFound
+	default:
+		return ErrorClassOther
+	}
+}
+
+// isFieldManagerConflict reports whether err is a server-side apply ownership conflict. These will
+// not resolve by retrying, unlike optimistic concurrency conflicts.
+func isFieldManagerConflict(err error) bool {
+	return apierrors.IsConflict(err) && apierrors.HasStatusCause(err, metav1.CauseTypeFieldManagerConflict)
+}
+
+// retryOnConflict runs fn, re-running it up to conflictRetries times with jittered exponential
+// backoff while it fails with a conflict. fn must re-fetch any state it depends on.
+func retryOnConflict(name string, c *utils.Config, fn func() error) error {
+	backoff := wait.Backoff{
+		Steps:    c.Kubernetes.ConflictRetries + 1,
+		Duration: c.Kubernetes.ConflictBackoff,
+		Factor:   2.0,
+		Jitter:   0.5,
+	}
+
+	attempt := 0
+	return retry.OnError(backoff, func(err error) bool {
+		// The last attempt's conflict is returned rather than retried
+		if ErrorClass(err) != ErrorClassConflict || attempt >= c.Kubernetes.ConflictRetries {
+			return false
+		}
+		attempt++
+		metrics.ConflictRetries.Inc()
+		log.Warn().Err(err).Str("name", name).Str("error_class", ErrorClassConflict).Int("attempt", attempt).Msg("Conflict writing workspace; retrying")
+		return true
+	}, fn)
+}
@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s/k8stest"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestErrorClass(t *testing.T) {
+	fieldConflict := apierrors.NewApplyConflict([]metav1.StatusCause{{Type: metav1.CauseTypeFieldManagerConflict}}, "conflict")
+
+	assert.Equal(t, "", ErrorClass(nil))
+	assert.Equal(t, ErrorClassConflict, ErrorClass(fmt.Errorf("wrapped: %w", apierrors.NewConflict(workspaceResource, "ws", errors.New("stale")))))
+	assert.Equal(t, ErrorClassFieldConflict, ErrorClass(fieldConflict))
+	assert.Equal(t, ErrorClassNotFound, ErrorClass(apierrors.NewNotFound(workspaceResource, "ws")))
+	assert.Equal(t, ErrorClassOther, ErrorClass(errors.New("boom")))
+	assert.Equal(t, ErrorClassPermanent, ErrorClass(fmt.Errorf("wrapped: %w", permanent(errors.New("unknown status")))))
+}
+
+func TestPermanentErrors(t *testing.T) {
+	assert.NoError(t, permanent(nil))
+	assert.False(t, IsPermanent(errors.New("apiserver unavailable")))
+
+	err := permanent(errors.New("unknown status: archived"))
+	assert.True(t, IsPermanent(fmt.Errorf("wrapped: %w", err)))
+	assert.Same(t, err, permanent(err))
+	assert.EqualError(t, err, "unknown status: archived")
+
+	// Settings that can never be applied fail permanently without touching the cluster
+	cfg := &utils.Config{Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"}}
+	err = ProcessWorkspace(context.Background(), nil, cfg, models.WorkspaceSettings{Name: "ws", Status: "archived"}, false)
+	assert.True(t, IsPermanent(err))
+
+	stores := []models.ObjectStore{{Name: "a", EnvVar: "S3_DATA"}, {Name: "b", EnvVar: "S3_DATA"}}
+	_, err = BuildWorkspace(models.WorkspaceSettings{Name: "ws", Stores: &[]models.Stores{{Object: stores}}}, cfg, PosixIdentity{}, nil)
+	assert.ErrorContains(t, err, "S3_DATA")
+	assert.True(t, IsPermanent(err))
+
+	cfg.Storage.Provider = "azure"
+	_, err = BuildWorkspace(models.WorkspaceSettings{Name: "ws"}, cfg, PosixIdentity{}, nil)
+	assert.True(t, IsPermanent(err))
+}
+
+func TestUpdateWorkspaceRetriesOnConflict(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	// The API server rejects the first applies with a conflict
+	conflicts := 0
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if conflicts > 0 {
+				conflicts--
+				return apierrors.NewConflict(workspaceResource, obj.GetName(), errors.New("the object has been modified"))
+			}
+			return k8stest.ServerSideApply(ctx, c, obj, patch, opts...)
+		},
+	}).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager", ConflictRetries: 3}}
+	payload := models.WorkspaceSettings{Name: "conflict-ws", Status: "updating"}
+
+	workspace, err := BuildWorkspace(payload, cfg, PosixIdentity{}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, fakeClient.Create(ctx, workspace))
+
+	conflicts = 2
+	retries := testutil.ToFloat64(metrics.ConflictRetries)
+	assert.NoError(t, UpdateWorkspace(ctx, fakeClient, payload, cfg))
+	assert.Zero(t, conflicts)
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.ConflictRetries)-retries)
+
+	// The same applies to messages that create or update
+	conflicts = 2
+	assert.NoError(t, CreateOrUpdateWorkspace(ctx, fakeClient, payload, cfg))
+	assert.Zero(t, conflicts)
+
+	// Once retries are exhausted the conflict is returned, and only the retries made are counted
+	conflicts = 10
+	cfg.Kubernetes.ConflictRetries = 1
+	retries = testutil.ToFloat64(metrics.ConflictRetries)
+	err = UpdateWorkspace(ctx, fakeClient, payload, cfg)
+	assert.Equal(t, ErrorClassConflict, ErrorClass(err))
+	assert.Equal(t, 8, conflicts)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.ConflictRetries)-retries)
+}
+
+func TestApplyWorkspaceIgnoresConcurrentWrites(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	// The controller writes the Workspace between the manager reading and applying it, which must
+	// not make the apply fail
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			other := &v1alpha1.Workspace{}
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), other); err == nil {
+				other.Annotations = map[string]string{"controller": "reconciled"}
+				if err := c.Update(ctx, other); err != nil {
+					return err
+				}
+			}
+			return k8stest.ServerSideApply(ctx, c, obj, patch, opts...)
+		},
+	}).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"}}
+	payload := models.WorkspaceSettings{Name: "busy-ws", Status: "updating"}
+	workspace, err := BuildWorkspace(payload, cfg, PosixIdentity{}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, fakeClient.Create(ctx, workspace))
+
+	assert.NoError(t, UpdateWorkspace(ctx, fakeClient, payload, cfg))
+	assert.NoError(t, CreateOrUpdateWorkspace(ctx, fakeClient, payload, cfg))
+}
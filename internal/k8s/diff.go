@@ -0,0 +1,178 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	workspacev1alpha1 "github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Operations a WorkspaceDiff can describe
+const (
+	DiffCreate = "create"
+	DiffUpdate = "update"
+	DiffDelete = "delete"
+	DiffNone   = "none"
+)
+
+// FieldChange is a single field that differs between the live and desired Workspace. Old is nil
+// for an added field and New is nil for a removed one.
+type FieldChange struct {
+	Path string `json:"path"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// WorkspaceDiff describes what processing a settings message would change in the cluster
+type WorkspaceDiff struct {
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace"`
+	Operation string        `json:"operation"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+// DiffWorkspace computes the Workspace that processing the settings would write and compares it
+// against the live Workspace, without changing anything in the cluster. Only the labels and spec
+// written by the manager are compared.
+func DiffWorkspace(ctx context.Context, k8sClient client.Client, c *utils.Config, payload models.WorkspaceSettings) (*WorkspaceDiff, error) {
+	diff := &WorkspaceDiff{Name: payload.Name, Namespace: c.Kubernetes.Namespace}
+
+	live := &workspacev1alpha1.Workspace{}
+	err := k8sClient.Get(ctx, client.ObjectKey{Name: payload.Name, Namespace: c.Kubernetes.Namespace}, live)
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to fetch workspace %s: %w", payload.Name, err)
+	}
+
+	switch payload.Status {
+	case "creating", "updating":
+	case "deleting":
+		diff.Operation = DiffNone
+		if exists {
+			diff.Operation = DiffDelete
+		}
+		return diff, nil
+	default:
+		return nil, permanent(fmt.Errorf("unknown status: %s", payload.Status))
+	}
+
+	identity, err := LookupIdentity(ctx, k8sClient, c, payload.Name)
+	if err != nil {
+		return nil, err
+	}
+	var existing *workspacev1alpha1.Workspace
+	if exists {
+		existing = live
+	}
+	desired, err := BuildWorkspace(payload, c, identity, existing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build workspace %s: %w", payload.Name, err)
+	}
+
+	if !exists {
+		live = &workspacev1alpha1.Workspace{}
+	}
+
+	// Labels set by others are left in place by server-side apply, so only compare ours
+	liveLabels := make(map[string]string)
+	for key := range desired.Labels {
+		if value, ok := live.Labels[key]; ok {
+			liveLabels[key] = value
+		}
+	}
+	if err := diffFields("metadata.labels", liveLabels, desired.Labels, &diff.Changes); err != nil {
+		return nil, err
+	}
+	if err := diffFields("spec", live.Spec, desired.Spec, &diff.Changes); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !exists:
+		diff.Operation = DiffCreate
+	case len(diff.Changes) > 0:
+		diff.Operation = DiffUpdate
+	default:
+		diff.Operation = DiffNone
+	}
+	return diff, nil
+}
+
+// diffFields appends the changes between two values, compared by their JSON representation
+func diffFields(path string, old, new any, changes *[]FieldChange) error {
+	oldValue, err := toJSONValue(old)
+	if err != nil {
+		return err
+	}
+	newValue, err := toJSONValue(new)
+	if err != nil {
+		return err
+	}
+	diffValues(path, oldValue, newValue, changes)
+	return nil
+}
+
+// toJSONValue converts v to the generic maps, slices and scalars it marshals to
+func toJSONValue(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// diffValues recursively compares two JSON values, recording a change for each differing leaf
+func diffValues(path string, old, new any, changes *[]FieldChange) {
+	oldMap, oldIsMap := old.(map[string]any)
+	newMap, newIsMap := new.(map[string]any)
+	if oldIsMap && newIsMap {
+		keys := make(map[string]bool)
+		for key := range oldMap {
+			keys[key] = true
+		}
+		for key := range newMap {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			diffValues(path+"."+key, oldMap[key], newMap[key], changes)
+		}
+		return
+	}
+
+	oldSlice, oldIsSlice := old.([]any)
+	newSlice, newIsSlice := new.([]any)
+	if oldIsSlice && newIsSlice {
+		for i := 0; i < max(len(oldSlice), len(newSlice)); i++ {
+			var oldItem, newItem any
+			if i < len(oldSlice) {
+				oldItem = oldSlice[i]
+			}
+			if i < len(newSlice) {
+				newItem = newSlice[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), oldItem, newItem, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, FieldChange{Path: path, Old: old, New: new})
+	}
+}
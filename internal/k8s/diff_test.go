@@ -0,0 +1,79 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s/k8stest"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDiffWorkspace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+		AWS:        utils.AWSConfig{Bucket: "test-bucket", Cluster: "test-cluster", FSID: "fs-12345"},
+		Storage:    utils.StorageConfig{Size: "10Gi"},
+	}
+	payload := models.WorkspaceSettings{
+		Name:   "diff-ws",
+		Status: "creating",
+		Stores: &[]models.Stores{{Block: []models.BlockStore{{Name: "data"}}}},
+	}
+
+	// Nothing exists yet
+	diff, err := DiffWorkspace(ctx, fakeClient, cfg, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, DiffCreate, diff.Operation)
+	assert.Contains(t, diff.Changes, FieldChange{Path: "spec.namespace", New: "ws-diff-ws"})
+
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, false))
+
+	// Unchanged settings
+	diff, err = DiffWorkspace(ctx, fakeClient, cfg, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, DiffNone, diff.Operation)
+	assert.Empty(t, diff.Changes)
+
+	// A new mapping
+	cfg.Storage.Size = "20Gi"
+	diff, err = DiffWorkspace(ctx, fakeClient, cfg, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, DiffUpdate, diff.Operation)
+	assert.Equal(t, []FieldChange{
+		{Path: "spec.storage.persistentVolumeClaims[0].size", Old: "10Gi", New: "20Gi"},
+		{Path: "spec.storage.persistentVolumes[0].size", Old: "10Gi", New: "20Gi"},
+	}, diff.Changes)
+
+	payload.Status = "deleting"
+	diff, err = DiffWorkspace(ctx, fakeClient, cfg, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, DiffDelete, diff.Operation)
+}
+
+func TestProcessWorkspaceDryRun(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
+	ctx := context.Background()
+	cfg := &utils.Config{Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"}}
+
+	payload := models.WorkspaceSettings{Name: "dry-ws", Status: "creating"}
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, true))
+
+	err := fakeClient.Get(ctx, client.ObjectKey{Name: "dry-ws", Namespace: "workspaces"}, &v1alpha1.Workspace{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
@@ -0,0 +1,26 @@
+package k8s
+
+import "errors"
+
+// PermanentError wraps an error that follows from the settings message and configuration alone,
+// such as an unknown status or settings that render an invalid name, so retrying cannot fix it
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// permanent marks err as permanent, returning nil unchanged
+func permanent(err error) error {
+	if err == nil || IsPermanent(err) {
+		return err
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, is a PermanentError
+func IsPermanent(err error) bool {
+	var p *PermanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,146 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	workspacev1alpha1 "github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultPosixID is the UID and GID used for every workspace when no ID range is configured
+const defaultPosixID = 1000
+
+// PosixIdentity is the owner of a workspace's files on the shared filesystem
+type PosixIdentity struct {
+	UID int64
+	GID int64
+}
+
+// AllocateIdentity returns the POSIX identity for a workspace. When an ID range is configured each
+// workspace is given the lowest free ID in the range, used as both UID and GID, and the allocation
+// is recorded in a ConfigMap so that it is stable across restarts and unique across replicas.
+// Allocations are never released, so a recreated workspace keeps ownership of its files. A
+// workspace that already exists without an allocation keeps the identity its access points use,
+// normally the default of 1000 from before the range was configured, so its files stay readable.
+func AllocateIdentity(ctx context.Context, k8sClient client.Client, c *utils.Config, workspaceName string) (PosixIdentity, error) {
+	if c.Identity.MinID == 0 && c.Identity.MaxID == 0 {
+		return PosixIdentity{UID: defaultPosixID, GID: defaultPosixID}, nil
+	}
+
+	var id int64
+	key := client.ObjectKey{Name: c.Identity.ConfigMap, Namespace: c.Kubernetes.Namespace}
+
+	// Concurrent allocations conflict on the ConfigMap resource version and are retried
+	err := retry.OnError(retry.DefaultBackoff, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		allocations := &corev1.ConfigMap{}
+		err := k8sClient.Get(ctx, key, allocations)
+		create := apierrors.IsNotFound(err)
+		if err != nil && !create {
+			return fmt.Errorf("failed to fetch identity allocations: %w", err)
+		}
+		if create {
+			allocations = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			}
+		}
+
+		// Reuse an existing allocation
+		if value, ok := allocations.Data[workspaceName]; ok {
+			id, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid identity %q allocated to workspace %s: %w", value, workspaceName, err)
+			}
+			return nil
+		}
+
+		id, err = newID(ctx, k8sClient, c, workspaceName, allocations.Data)
+		if err != nil {
+			return err
+		}
+
+		if allocations.Data == nil {
+			allocations.Data = make(map[string]string)
+		}
+		allocations.Data[workspaceName] = strconv.FormatInt(id, 10)
+
+		if create {
+			return k8sClient.Create(ctx, allocations)
+		}
+		return k8sClient.Update(ctx, allocations)
+	})
+	if err != nil {
+		return PosixIdentity{}, fmt.Errorf("failed to allocate identity for workspace %s: %w", workspaceName, err)
+	}
+
+	log.Debug().Str("name", workspaceName).Int64("id", id).Msg("Workspace identity allocated")
+	return PosixIdentity{UID: id, GID: id}, nil
+}
+
+// LookupIdentity returns the POSIX identity allocated to a workspace, or the identity it would be
+// allocated, without recording an allocation
+func LookupIdentity(ctx context.Context, k8sClient client.Client, c *utils.Config, workspaceName string) (PosixIdentity, error) {
+	if c.Identity.MinID == 0 && c.Identity.MaxID == 0 {
+		return PosixIdentity{UID: defaultPosixID, GID: defaultPosixID}, nil
+	}
+
+	allocations := &corev1.ConfigMap{}
+	err := k8sClient.Get(ctx, client.ObjectKey{Name: c.Identity.ConfigMap, Namespace: c.Kubernetes.Namespace}, allocations)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return PosixIdentity{}, fmt.Errorf("failed to fetch identity allocations: %w", err)
+	}
+
+	var id int64
+	if value, ok := allocations.Data[workspaceName]; ok {
+		id, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return PosixIdentity{}, fmt.Errorf("invalid identity %q allocated to workspace %s: %w", value, workspaceName, err)
+		}
+	} else {
+		id, err = newID(ctx, k8sClient, c, workspaceName, allocations.Data)
+		if err != nil {
+			return PosixIdentity{}, err
+		}
+	}
+	return PosixIdentity{UID: id, GID: id}, nil
+}
+
+// newID returns the ID to allocate to a workspace without one: the UID its existing access points
+// already use, or else the lowest free ID in the range
+func newID(ctx context.Context, k8sClient client.Client, c *utils.Config, workspaceName string, allocations map[string]string) (int64, error) {
+	workspace := &workspacev1alpha1.Workspace{}
+	err := k8sClient.Get(ctx, client.ObjectKey{Name: workspaceName, Namespace: c.Kubernetes.Namespace}, workspace)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return 0, fmt.Errorf("failed to fetch workspace %s: %w", workspaceName, err)
+	}
+	if err == nil && len(workspace.Spec.AWS.EFS.AccessPoints) > 0 {
+		return workspace.Spec.AWS.EFS.AccessPoints[0].User.UID, nil
+	}
+	return nextFreeID(allocations, c.Identity.MinID, c.Identity.MaxID)
+}
+
+// nextFreeID returns the lowest ID in [min, max] that is not already allocated
+func nextFreeID(allocations map[string]string, min, max int64) (int64, error) {
+	used := make(map[int64]bool, len(allocations))
+	for _, value := range allocations {
+		if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+			used[id] = true
+		}
+	}
+
+	for id := min; id <= max; id++ {
+		if !used[id] {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("no free identities left in range %d-%d", min, max)
+}
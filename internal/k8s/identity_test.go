@@ -0,0 +1,154 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s/k8stest"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAllocateIdentity(t *testing.T) {
+	scheme, err := NewScheme()
+	assert.NoError(t, err)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+		Identity:   utils.IdentityConfig{MinID: 2000, MaxID: 2001, ConfigMap: "identities"},
+	}
+
+	first, err := AllocateIdentity(ctx, fakeClient, cfg, "ws-a")
+	assert.NoError(t, err)
+	assert.Equal(t, PosixIdentity{UID: 2000, GID: 2000}, first)
+
+	second, err := AllocateIdentity(ctx, fakeClient, cfg, "ws-b")
+	assert.NoError(t, err)
+	assert.Equal(t, PosixIdentity{UID: 2001, GID: 2001}, second)
+
+	// Allocations are stable
+	again, err := AllocateIdentity(ctx, fakeClient, cfg, "ws-a")
+	assert.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	// And persisted in the ConfigMap
+	allocations := &corev1.ConfigMap{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "identities", Namespace: "workspaces"}, allocations))
+	assert.Equal(t, map[string]string{"ws-a": "2000", "ws-b": "2001"}, allocations.Data)
+
+	// The range is exhausted
+	_, err = AllocateIdentity(ctx, fakeClient, cfg, "ws-c")
+	assert.Error(t, err)
+}
+
+func TestAllocateIdentityKeepsExistingWorkspaceIdentity(t *testing.T) {
+	scheme, err := NewScheme()
+	assert.NoError(t, err)
+
+	// A workspace created before the range was configured uses the default identity
+	existing := &v1alpha1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "ws-old", Namespace: "workspaces"},
+		Spec: v1alpha1.WorkspaceSpec{AWS: v1alpha1.AWSSpec{EFS: v1alpha1.EFSSpec{AccessPoints: []v1alpha1.EFSAccess{
+			{Name: "home", User: v1alpha1.User{UID: 1000, GID: 1000}},
+		}}}},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+		Identity:   utils.IdentityConfig{MinID: 2000, MaxID: 2999, ConfigMap: "identities"},
+	}
+
+	lookedUp, err := LookupIdentity(ctx, fakeClient, cfg, "ws-old")
+	assert.NoError(t, err)
+	assert.Equal(t, PosixIdentity{UID: 1000, GID: 1000}, lookedUp)
+
+	identity, err := AllocateIdentity(ctx, fakeClient, cfg, "ws-old")
+	assert.NoError(t, err)
+	assert.Equal(t, PosixIdentity{UID: 1000, GID: 1000}, identity)
+
+	// New workspaces are allocated from the range
+	identity, err = AllocateIdentity(ctx, fakeClient, cfg, "ws-new")
+	assert.NoError(t, err)
+	assert.Equal(t, PosixIdentity{UID: 2000, GID: 2000}, identity)
+
+	allocations := &corev1.ConfigMap{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "identities", Namespace: "workspaces"}, allocations))
+	assert.Equal(t, map[string]string{"ws-old": "1000", "ws-new": "2000"}, allocations.Data)
+}
+
+func TestManagerClientReadsConfigMapsFromAPIServer(t *testing.T) {
+	scheme, err := NewScheme()
+	assert.NoError(t, err)
+
+	// The cache has a stale allocation that the API server does not
+	stale := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "identities", Namespace: "workspaces"},
+		Data:       map[string]string{"ws-a": "2000"},
+	}
+	workspace := &v1alpha1.Workspace{ObjectMeta: metav1.ObjectMeta{Name: "ws-a", Namespace: "workspaces"}}
+	cached := fake.NewClientBuilder().WithScheme(scheme).WithObjects(stale, workspace).Build()
+	apiServer := fake.NewClientBuilder().WithScheme(scheme).Build()
+	k8sClient := apiReaderClient{Client: cached, apiReader: apiServer}
+	ctx := context.Background()
+
+	err = k8sClient.Get(ctx, client.ObjectKeyFromObject(stale), &corev1.ConfigMap{})
+	assert.True(t, apierrors.IsNotFound(err))
+	assert.NoError(t, k8sClient.Get(ctx, client.ObjectKeyFromObject(workspace), &v1alpha1.Workspace{}))
+}
+
+func TestAllocateIdentityDisabled(t *testing.T) {
+	identity, err := AllocateIdentity(context.Background(), nil, &utils.Config{}, "ws")
+	assert.NoError(t, err)
+	assert.Equal(t, PosixIdentity{UID: 1000, GID: 1000}, identity)
+}
+
+func TestCreateWorkspaceWithIdentity(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+		Identity:   utils.IdentityConfig{MinID: 5000, MaxID: 5999, ConfigMap: "identities"},
+		Storage:    utils.StorageConfig{Permissions: "750"},
+	}
+
+	payload := models.WorkspaceSettings{
+		Name:   "identity-ws",
+		Status: "creating",
+		Stores: &[]models.Stores{
+			{Block: []models.BlockStore{{Name: "home"}, {Name: "shared", Permissions: "775"}}},
+		},
+	}
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, false))
+
+	created := &v1alpha1.Workspace{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "identity-ws", Namespace: "workspaces"}, created))
+
+	accessPoints := created.Spec.AWS.EFS.AccessPoints
+	assert.Equal(t, v1alpha1.User{UID: 5000, GID: 5000}, accessPoints[0].User)
+	assert.Equal(t, "750", accessPoints[0].Permissions)
+	assert.Equal(t, "775", accessPoints[1].Permissions)
+
+	// Overrides are checked like storage.permissions
+	payload.Stores = &[]models.Stores{{Block: []models.BlockStore{{Name: "shared", Permissions: "rwxr-xr-x"}}}}
+	err := ProcessWorkspace(ctx, fakeClient, cfg, payload, false)
+	assert.ErrorContains(t, err, `permissions "rwxr-xr-x"`)
+	assert.True(t, IsPermanent(err))
+}
@@ -0,0 +1,41 @@
+// Package k8stest holds helpers for testing code that writes Workspaces with the fake client
+package k8stest
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// ServerSideApply emulates apply patches, which the fake client does not support, by creating the
+// object or replacing the existing one. Like the API server, it rejects applies without a field
+// manager. Use it as the Patch interceptor of a fake client.
+func ServerSideApply(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Patch(ctx, obj, patch, opts...)
+	}
+	if (&client.PatchOptions{}).ApplyOptions(opts).FieldManager == "" {
+		return apierrors.NewBadRequest("PatchOptions.fieldManager is required for apply requests")
+	}
+
+	existing := obj.DeepCopyObject().(client.Object)
+	err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if apierrors.IsNotFound(err) {
+		return c.Create(ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+
+	// An apply with a resource version fails with a conflict if it is stale
+	if obj.GetResourceVersion() == "" {
+		obj.SetResourceVersion(existing.GetResourceVersion())
+	}
+	return c.Update(ctx, obj)
+}
+
+// Interceptor is a set of fake client interceptors that emulates server-side apply
+var Interceptor = interceptor.Funcs{Patch: ServerSideApply}
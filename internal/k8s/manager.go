@@ -2,24 +2,30 @@ package k8s
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"reflect"
 	"time"
 
 	workspacev1alpha1 "github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/metrics"
 	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
 	"github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/tools/cache"
+	toolscache "k8s.io/client-go/tools/cache"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
-// InitializeManager initializes and returns a Kubernetes manager
-func InitializeManager() (manager.Manager, error) {
-	// Create a new runtime scheme
+// NewScheme returns a runtime scheme with the types the manager reads and writes
+func NewScheme() (*runtime.Scheme, error) {
 	scheme := runtime.NewScheme()
 
 	// Register the Workspace CRD
@@ -27,53 +33,181 @@ func InitializeManager() (manager.Manager, error) {
 		return nil, fmt.Errorf("failed to register Workspace CRD scheme: %w", err)
 	}
 
+	// Register the core types for the ConfigMap holding identity allocations
+	if err := corev1.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("failed to register core scheme: %w", err)
+	}
+
+	return scheme, nil
+}
+
+// NewClient returns an uncached client for the cluster in the current kubeconfig context, for
+// commands that run outside the manager
+func NewClient() (client.Client, error) {
+	scheme, err := NewScheme()
+	if err != nil {
+		return nil, err
+	}
+
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return k8sClient, nil
+}
+
+// apiReaderClient is a client that reads ConfigMaps with an API reader and everything else through
+// the client's cache. Identity allocations are read straight from the API server, so they are never
+// stale and no ConfigMap informer, or the RBAC to list and watch ConfigMaps, is needed.
+type apiReaderClient struct {
+	client.Client
+	apiReader client.Reader
+}
+
+func (c apiReaderClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if _, ok := obj.(*corev1.ConfigMap); ok {
+		return c.apiReader.Get(ctx, key, obj, opts...)
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+// NewManagerClient returns the client the manager's work uses: the manager's cached client, except
+// that ConfigMaps are read with its API reader
+func NewManagerClient(mgr manager.Manager) client.Client {
+	return apiReaderClient{Client: mgr.GetClient(), apiReader: mgr.GetAPIReader()}
+}
+
+// InitializeManager initializes and returns a Kubernetes manager
+func InitializeManager(c *utils.Config) (manager.Manager, error) {
+	scheme, err := NewScheme()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the manager
+	// The manager also serves the Prometheus metrics registered in the metrics package. Only the
+	// namespace holding the Workspace CRs is cached, so that several isolated managers can share a
+	// cluster and each only needs RBAC for its own namespace
 	k8sMgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		Cache: cache.Options{
+			DefaultNamespaces: map[string]cache.Config{
+				c.Kubernetes.Namespace: {},
+			},
+		},
+		Metrics: metricsserver.Options{
+			BindAddress: c.Metrics.BindAddress,
+		},
+		HealthProbeBindAddress: c.Health.BindAddress,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes manager: %w", err)
 	}
 
+	// Liveness only depends on the manager process; readiness waits for the cache to sync
+	if err := k8sMgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return nil, fmt.Errorf("failed to add liveness check: %w", err)
+	}
+	if err := k8sMgr.AddReadyzCheck("cache-sync", cacheSyncCheck(k8sMgr)); err != nil {
+		return nil, fmt.Errorf("failed to add readiness check: %w", err)
+	}
+
 	log.Info().Msg("Kubernetes manager initialized")
 	return k8sMgr, nil
 }
 
-// ProcessWorkspace processes a WorkspaceSettings pulsar message payload
-func ProcessWorkspace(ctx context.Context, client client.Client, c *utils.Config, payload models.WorkspaceSettings) error {
+// cacheSyncCheck reports ready once the manager's informer cache has synced
+func cacheSyncCheck(mgr manager.Manager) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Second)
+		defer cancel()
+
+		if !mgr.GetCache().WaitForCacheSync(ctx) {
+			return errors.New("informer cache has not synced")
+		}
+		return nil
+	}
+}
+
+// ProcessWorkspace processes a WorkspaceSettings pulsar message payload. In dry-run mode the
+// changes it would make are logged as a structured diff and the cluster is left untouched.
+func ProcessWorkspace(ctx context.Context, client client.Client, c *utils.Config, payload models.WorkspaceSettings, dryRun bool) (err error) {
+	start := time.Now()
+	operation := payload.Status
+	if dryRun {
+		operation = metrics.OperationDryRun
+	}
+	defer func() {
+		metrics.ObserveProcessWorkspace(operation, start, ErrorClass(err))
+	}()
+
+	if dryRun {
+		diff, err := DiffWorkspace(ctx, client, c, payload)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("name", diff.Name).Str("namespace", diff.Namespace).Str("operation", diff.Operation).Interface("changes", diff.Changes).Msg("Dry run: workspace not changed")
+		return nil
+	}
+
 	switch payload.Status {
-	case "creating":
-		return CreateWorkspace(ctx, client, payload, c)
-	case "updating":
-		return UpdateWorkspace(ctx, client, payload, c)
+	case "creating", "updating":
+		return CreateOrUpdateWorkspace(ctx, client, payload, c)
 	case "deleting":
-		return DeleteWorkspace(ctx, client, payload)
+		return DeleteWorkspace(ctx, client, payload, c)
 	default:
-		return fmt.Errorf("unknown status: %s", payload.Status)
+		return permanent(fmt.Errorf("unknown status: %s", payload.Status))
 	}
 }
 
 // ListenForWorkspaceStatusUpdates listens for updates to the Workspace CRD
-func ListenForWorkspaceStatusUpdates(ctx context.Context, mgr manager.Manager, statusUpdates chan models.WorkspaceStatus) error {
+func ListenForWorkspaceStatusUpdates(ctx context.Context, mgr manager.Manager, statusUpdates *StatusQueue) error {
 	informer, err := mgr.GetCache().GetInformer(ctx, &workspacev1alpha1.Workspace{})
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create informer for Workspace CRD")
 		return err
 	}
 
-	// Add event handler to the informer
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	// Add event handlers to the informer
+	informer.AddEventHandler(toolscache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			handleAdd(obj, isInInitialList, statusUpdates)
+		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			handleUpdate(oldObj, newObj, statusUpdates)
 		},
+		DeleteFunc: func(obj interface{}) {
+			handleDelete(obj, statusUpdates)
+		},
 	})
 
 	log.Info().Msg("Workspace CRD informer started")
 	return nil
 }
 
+// handleAdd handles a Workspace being observed for the first time. Workspaces in the initial list
+// already existed when the manager started, so their status is sent as synced rather than created.
+func handleAdd(obj interface{}, isInInitialList bool, statusUpdates *StatusQueue) {
+	workspace, ok := obj.(*workspacev1alpha1.Workspace)
+	if !ok {
+		log.Error().Msg("Failed to cast added object to Workspace")
+		return
+	}
+
+	event := models.EventCreated
+	if isInInitialList {
+		event = models.EventSynced
+	}
+	statusUpdates.Push(newWorkspaceStatus(workspace, event))
+}
+
 // handleUpdate handles updates to the Workspace CRD
-func handleUpdate(oldObj, newObj interface{}, statusUpdates chan models.WorkspaceStatus) {
+func handleUpdate(oldObj, newObj interface{}, statusUpdates *StatusQueue) {
 
 	oldWorkspace, ok := oldObj.(*workspacev1alpha1.Workspace)
 	if !ok {
@@ -95,21 +229,33 @@ func handleUpdate(oldObj, newObj interface{}, statusUpdates chan models.Workspac
 		return
 	}
 
-	// Create a WorkspaceStatus object to send to the channel
-	statusUpdate := models.WorkspaceStatus{
-		Name:        newWorkspace.Name,
-		Namespace:   newWorkspace.Status.Namespace,
-		AWS:         newWorkspace.Status.AWS,
-		State:       newWorkspace.Status.State,
-		LastUpdated: time.Now().UTC(),
+	statusUpdates.Push(newWorkspaceStatus(newWorkspace, models.EventUpdated))
+}
+
+// handleDelete handles a Workspace being removed from the cluster
+func handleDelete(obj interface{}, statusUpdates *StatusQueue) {
+	// If the watch missed the delete, the informer passes the last known state in a tombstone
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
 	}
 
-	// Send the status update to the channel
-	select {
-	case statusUpdates <- statusUpdate:
-		log.Info().Msgf("Status update sent to channel: %v", statusUpdate)
-	default:
-		log.Warn().Msg("Status updates channel is full; dropping update")
+	workspace, ok := obj.(*workspacev1alpha1.Workspace)
+	if !ok {
+		log.Error().Msg("Failed to cast deleted object to Workspace")
+		return
 	}
 
+	statusUpdates.Push(newWorkspaceStatus(workspace, models.EventDeleted))
+}
+
+// newWorkspaceStatus creates a WorkspaceStatus message for a Workspace event
+func newWorkspaceStatus(workspace *workspacev1alpha1.Workspace, event string) models.WorkspaceStatus {
+	return models.WorkspaceStatus{
+		Event:       event,
+		Name:        workspace.Name,
+		Namespace:   workspace.Status.Namespace,
+		AWS:         workspace.Status.AWS,
+		State:       workspace.Status.State,
+		LastUpdated: time.Now().UTC(),
+	}
 }
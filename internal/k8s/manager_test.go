@@ -7,10 +7,12 @@ import (
 	"github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
 	"github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 func TestHandleUpdate(t *testing.T) {
-	ch := make(chan models.WorkspaceStatus, 1)
+	queue := NewStatusQueue()
 
 	oldObj := &v1alpha1.Workspace{
 		Status: v1alpha1.WorkspaceStatus{
@@ -26,14 +28,50 @@ func TestHandleUpdate(t *testing.T) {
 		},
 	}
 
-	handleUpdate(oldObj, newObj, ch)
+	handleUpdate(oldObj, newObj, queue)
 
-	select {
-	case msg := <-ch:
+	statuses := queue.Drain()
+	if assert.Len(t, statuses, 1, "expected status update but got none") {
+		msg := statuses[0]
+		assert.Equal(t, models.EventUpdated, msg.Event)
 		assert.Equal(t, "Running", msg.State)
 		assert.Equal(t, "ws-demo", msg.Namespace)
 		assert.WithinDuration(t, time.Now().UTC(), msg.LastUpdated, time.Second)
-	default:
-		t.Fatal("expected status update but got none")
 	}
 }
+
+func TestHandleAddAndDelete(t *testing.T) {
+	queue := NewStatusQueue()
+
+	workspace := &v1alpha1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+		Status: v1alpha1.WorkspaceStatus{
+			State:     "Ready",
+			Namespace: "ws-demo",
+		},
+	}
+
+	handleAdd(workspace, false, queue)
+	statuses := queue.Drain()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, models.EventCreated, statuses[0].Event)
+
+	// Workspaces listed when the informer starts already existed
+	handleAdd(workspace, true, queue)
+	statuses = queue.Drain()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, models.EventSynced, statuses[0].Event)
+
+	handleDelete(workspace, queue)
+	statuses = queue.Drain()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, models.EventDeleted, statuses[0].Event)
+
+	// A delete missed by the watch arrives as a tombstone
+	handleDelete(cache.DeletedFinalStateUnknown{Key: "workspaces/demo", Obj: workspace}, queue)
+	statuses = queue.Drain()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, models.EventDeleted, statuses[0].Event)
+	assert.Equal(t, "demo", statuses[0].Name)
+	assert.Equal(t, "Ready", statuses[0].State)
+}
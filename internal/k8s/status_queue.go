@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+)
+
+// queuedStatus is a pending status update tagged with the order it was pushed in
+type queuedStatus struct {
+	status models.WorkspaceStatus
+	seq    uint64
+}
+
+// StatusQueue buffers workspace status updates without blocking the informer or dropping updates.
+// Only the latest pending update is kept for each workspace, so the queue never holds more than
+// one entry per workspace and a newer state always replaces an older one that has not been sent.
+type StatusQueue struct {
+	mu      sync.Mutex
+	order   []string
+	pending map[string]queuedStatus
+	seq     uint64
+	ready   chan struct{}
+}
+
+// NewStatusQueue creates an empty StatusQueue
+func NewStatusQueue() *StatusQueue {
+	return &StatusQueue{
+		pending: make(map[string]queuedStatus),
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// Push records the latest status for a workspace, replacing any update for it that is still queued
+func (q *StatusQueue) Push(status models.WorkspaceStatus) {
+	q.add(status, true)
+}
+
+// Requeue puts back an update that could not be sent. It is dropped if a newer update for the
+// workspace has been pushed since, as that one replaces it anyway.
+func (q *StatusQueue) Requeue(status models.WorkspaceStatus) {
+	q.add(status, false)
+}
+
+// add queues status, replacing a pending update for the workspace only if replace is set, and wakes
+// up the forwarder
+func (q *StatusQueue) add(status models.WorkspaceStatus, replace bool) {
+	q.mu.Lock()
+	if _, ok := q.pending[status.Name]; ok {
+		if !replace {
+			q.mu.Unlock()
+			return
+		}
+		metrics.StatusUpdatesCoalesced.Inc()
+	} else {
+		q.order = append(q.order, status.Name)
+	}
+	q.seq++
+	q.pending[status.Name] = queuedStatus{status: status, seq: q.seq}
+	q.mu.Unlock()
+
+	// Wake up the forwarder if it is waiting
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of workspaces with a pending update
+func (q *StatusQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.order)
+}
+
+// Forward sends queued updates to out in order until ctx is cancelled, blocking while out is full.
+// An update is only removed once it has been sent, so nothing is lost when forwarding stops.
+func (q *StatusQueue) Forward(ctx context.Context, out chan<- models.WorkspaceStatus) {
+	for {
+		head, ok := q.peek()
+		if !ok {
+			select {
+			case <-q.ready:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case out <- head.status:
+			q.remove(head)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Drain removes and returns every queued update in order
+func (q *StatusQueue) Drain() []models.WorkspaceStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	statuses := make([]models.WorkspaceStatus, 0, len(q.order))
+	for _, name := range q.order {
+		statuses = append(statuses, q.pending[name].status)
+	}
+	q.order = nil
+	q.pending = make(map[string]queuedStatus)
+	return statuses
+}
+
+// peek returns the oldest queued update without removing it
+func (q *StatusQueue) peek() (queuedStatus, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.order) == 0 {
+		return queuedStatus{}, false
+	}
+	return q.pending[q.order[0]], true
+}
+
+// remove removes a sent update, unless it was replaced by a newer one while being sent
+func (q *StatusQueue) remove(sent queuedStatus) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	name := sent.status.Name
+	if len(q.order) == 0 || q.order[0] != name || q.pending[name].seq != sent.seq {
+		return
+	}
+	q.order = q.order[1:]
+	delete(q.pending, name)
+}
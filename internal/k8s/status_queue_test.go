@@ -0,0 +1,67 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusQueueCoalescesPerWorkspace(t *testing.T) {
+	q := NewStatusQueue()
+
+	q.Push(models.WorkspaceStatus{Name: "a", State: "Pending"})
+	q.Push(models.WorkspaceStatus{Name: "b", State: "Pending"})
+	q.Push(models.WorkspaceStatus{Name: "a", State: "Ready"})
+
+	assert.Equal(t, 2, q.Len())
+
+	statuses := q.Drain()
+	assert.Equal(t, []models.WorkspaceStatus{
+		{Name: "a", State: "Ready"},
+		{Name: "b", State: "Pending"},
+	}, statuses)
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestStatusQueueForward(t *testing.T) {
+	q := NewStatusQueue()
+	out := make(chan models.WorkspaceStatus, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Forward(ctx, out)
+	}()
+
+	q.Push(models.WorkspaceStatus{Name: "a", State: "Pending"})
+	assert.Equal(t, "Pending", (<-out).State)
+
+	// With the channel full, further updates stay queued rather than being dropped
+	q.Push(models.WorkspaceStatus{Name: "b", State: "Pending"})
+	q.Push(models.WorkspaceStatus{Name: "c", State: "Pending"})
+	q.Push(models.WorkspaceStatus{Name: "c", State: "Error"})
+	assert.Eventually(t, func() bool { return len(out) == 1 }, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	assert.Equal(t, "b", (<-out).Name)
+	assert.Equal(t, []models.WorkspaceStatus{{Name: "c", State: "Error"}}, q.Drain())
+}
+
+func TestStatusQueueRequeue(t *testing.T) {
+	q := NewStatusQueue()
+
+	// A failed update goes back on the queue
+	q.Requeue(models.WorkspaceStatus{Name: "a", State: "Pending"})
+	assert.Equal(t, []models.WorkspaceStatus{{Name: "a", State: "Pending"}}, q.Drain())
+
+	// but not over a newer update pushed while it was being sent
+	q.Push(models.WorkspaceStatus{Name: "a", State: "Ready"})
+	q.Requeue(models.WorkspaceStatus{Name: "a", State: "Pending"})
+	assert.Equal(t, []models.WorkspaceStatus{{Name: "a", State: "Ready"}}, q.Drain())
+}
@@ -0,0 +1,131 @@
+package k8s
+
+import (
+	"fmt"
+
+	workspacev1alpha1 "github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+)
+
+// StorageProvider maps the object and block stores of a workspace onto the Workspace spec for a
+// particular storage backend. The existing Workspace is nil if it has not been created yet.
+type StorageProvider interface {
+	MapStores(req models.WorkspaceSettings, c *utils.Config, identity PosixIdentity, existing *workspacev1alpha1.Workspace, spec *workspacev1alpha1.WorkspaceSpec) error
+}
+
+// NewStorageProvider returns the storage provider with the given name. An empty name selects the
+// AWS provider.
+func NewStorageProvider(name string) (StorageProvider, error) {
+	switch name {
+	case "", utils.StorageProviderAWS:
+		return awsStorageProvider{}, nil
+	case utils.StorageProviderGeneric:
+		return genericStorageProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage provider %q", name)
+	}
+}
+
+// awsStorageProvider maps object stores to S3 access points and block stores to EFS access points
+// mounted through statically provisioned PVs, all under a per-workspace IAM role
+type awsStorageProvider struct{}
+
+func (awsStorageProvider) MapStores(req models.WorkspaceSettings, c *utils.Config, identity PosixIdentity, existing *workspacev1alpha1.Workspace, spec *workspacev1alpha1.WorkspaceSpec) error {
+	objectStores, blockStores := splitStores(req)
+
+	// Map ObjectStores to S3Buckets together so that their environment variables do not collide
+	s3Buckets, err := MapObjectStoresToS3Buckets(req, c, objectStores, existing)
+	if err != nil {
+		return err
+	}
+	// Map BlockStores to EFSAccessPoints
+	efsAccessPoints, err := MapBlockStoresToEFSAccessPoints(req, c, blockStores, identity)
+	if err != nil {
+		return err
+	}
+
+	// Generate storage configuration with a PV and PVC for each block store
+	storageConfig, err := GenerateStorageConfig(req, c, blockStores, existing)
+	if err != nil {
+		return err
+	}
+
+	roleName, err := c.Naming.Render(utils.NamingRoleName, namingData(req, c, nil, 0))
+	if err != nil {
+		return err
+	}
+
+	spec.AWS = workspacev1alpha1.AWSSpec{
+		RoleName: roleName,
+		EFS: workspacev1alpha1.EFSSpec{
+			AccessPoints: efsAccessPoints,
+		},
+		S3: workspacev1alpha1.S3Spec{
+			Buckets: s3Buckets,
+		},
+	}
+	spec.Storage = storageConfig
+	return nil
+}
+
+// genericStorageProvider maps block stores to dynamically provisioned PVCs from a storage class
+// and object stores to plain bucket and prefix settings for an S3-compatible store such as MinIO.
+// No AWS role, access points or PVs are requested.
+type genericStorageProvider struct{}
+
+func (genericStorageProvider) MapStores(req models.WorkspaceSettings, c *utils.Config, _ PosixIdentity, _ *workspacev1alpha1.Workspace, spec *workspacev1alpha1.WorkspaceSpec) error {
+	objectStores, blockStores := splitStores(req)
+
+	buckets, err := mapObjectStores(objectStores, c.Storage.Bucket)
+	if err != nil {
+		return err
+	}
+
+	var pvcs []workspacev1alpha1.PVCSpec
+	for i, blockStore := range blockStores {
+		pvcName, err := c.Naming.Render(utils.NamingPVCName, namingData(req, c, blockStore, i))
+		if err != nil {
+			return err
+		}
+
+		size, storageClass, err := blockStoreVolume(blockStore, c)
+		if err != nil {
+			return err
+		}
+
+		pvcs = append(pvcs, workspacev1alpha1.PVCSpec{
+			PVSpec: workspacev1alpha1.PVSpec{
+				Name:         pvcName,
+				StorageClass: storageClass,
+				Size:         size,
+			},
+		})
+	}
+
+	// The CRD only has an S3 bucket list under the AWS spec, so the S3-compatible buckets are
+	// listed there without a role or access points
+	spec.AWS = workspacev1alpha1.AWSSpec{
+		S3: workspacev1alpha1.S3Spec{
+			Buckets: buckets,
+		},
+	}
+	spec.Storage = workspacev1alpha1.StorageSpec{
+		PersistentVolumeClaims: pvcs,
+	}
+	return nil
+}
+
+// splitStores collects the object and block stores from all of the workspace's store groups
+func splitStores(req models.WorkspaceSettings) ([]models.ObjectStore, []models.BlockStore) {
+	var objectStores []models.ObjectStore
+	var blockStores []models.BlockStore
+
+	if req.Stores != nil {
+		for _, store := range *req.Stores {
+			objectStores = append(objectStores, store.Object...)
+			blockStores = append(blockStores, store.Block...)
+		}
+	}
+	return objectStores, blockStores
+}
@@ -0,0 +1,109 @@
+package k8s
+
+import (
+	"testing"
+
+	workspacev1alpha1 "github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenericStorageProvider(t *testing.T) {
+	cfg := &utils.Config{
+		AWS: utils.AWSConfig{Cluster: "test-cluster", FSID: "fs-12345"},
+		Storage: utils.StorageConfig{
+			Provider:     utils.StorageProviderGeneric,
+			Bucket:       "minio-bucket",
+			Size:         "10Gi",
+			StorageClass: "local-path",
+		},
+	}
+
+	workspace, err := BuildWorkspace(models.WorkspaceSettings{
+		Name: "ws",
+		Stores: &[]models.Stores{{
+			Object: []models.ObjectStore{{Name: "data"}, {Name: "other", Bucket: "other-bucket", Prefix: "shared/"}},
+			Block:  []models.BlockStore{{Name: "home"}, {Name: "scratch", Size: "50Gi"}},
+		}},
+	}, cfg, PosixIdentity{UID: 1000, GID: 1000}, nil)
+	assert.NoError(t, err)
+
+	// No AWS role, access points or PVs
+	assert.Empty(t, workspace.Spec.AWS.RoleName)
+	assert.Empty(t, workspace.Spec.AWS.EFS.AccessPoints)
+	assert.Empty(t, workspace.Spec.Storage.PersistentVolumes)
+
+	assert.Equal(t, []workspacev1alpha1.S3Bucket{
+		{Name: "minio-bucket", Path: "data/", EnvVar: "S3_BUCKET_WORKSPACE"},
+		{Name: "other-bucket", Path: "shared/", EnvVar: "S3_BUCKET_WORKSPACE_OTHER"},
+	}, workspace.Spec.AWS.S3.Buckets)
+
+	assert.Equal(t, []workspacev1alpha1.PVCSpec{
+		{PVSpec: workspacev1alpha1.PVSpec{Name: "pvc-ws-home", StorageClass: "local-path", Size: "10Gi"}},
+		{PVSpec: workspacev1alpha1.PVSpec{Name: "pvc-ws-scratch", StorageClass: "local-path", Size: "50Gi"}},
+	}, workspace.Spec.Storage.PersistentVolumeClaims)
+}
+
+func TestStorageProvidersMapObjectStoresAlike(t *testing.T) {
+	cfg := &utils.Config{
+		AWS:     utils.AWSConfig{Cluster: "test-cluster", Bucket: "shared-bucket"},
+		Storage: utils.StorageConfig{Bucket: "shared-bucket"},
+	}
+	req := models.WorkspaceSettings{
+		Name: "ws",
+		Stores: &[]models.Stores{{
+			Object: []models.ObjectStore{{Name: "data"}, {Name: "other", Bucket: "other-bucket", Prefix: "shared/", EnvVar: "S3_OTHER"}},
+		}},
+	}
+
+	var aws, generic workspacev1alpha1.WorkspaceSpec
+	assert.NoError(t, awsStorageProvider{}.MapStores(req, cfg, PosixIdentity{}, nil, &aws))
+	assert.NoError(t, genericStorageProvider{}.MapStores(req, cfg, PosixIdentity{}, nil, &generic))
+
+	// The providers only differ in the access points
+	for i := range aws.AWS.S3.Buckets {
+		aws.AWS.S3.Buckets[i].AccessPointName = ""
+	}
+	assert.Equal(t, aws.AWS.S3.Buckets, generic.AWS.S3.Buckets)
+}
+
+func TestNewStorageProvider(t *testing.T) {
+	provider, err := NewStorageProvider("")
+	assert.NoError(t, err)
+	assert.IsType(t, awsStorageProvider{}, provider)
+
+	provider, err = NewStorageProvider(utils.StorageProviderGeneric)
+	assert.NoError(t, err)
+	assert.IsType(t, genericStorageProvider{}, provider)
+
+	_, err = NewStorageProvider("azure")
+	assert.Error(t, err)
+}
+
+func TestBlockStoreOverridesAreValidated(t *testing.T) {
+	for _, provider := range []string{utils.StorageProviderAWS, utils.StorageProviderGeneric} {
+		cfg := &utils.Config{
+			AWS:     utils.AWSConfig{Cluster: "test-cluster", FSID: "fs-12345", Bucket: "bucket"},
+			Storage: utils.StorageConfig{Provider: provider, Bucket: "bucket", Size: "10Gi", StorageClass: "standard"},
+		}
+		build := func(store models.BlockStore) error {
+			_, err := BuildWorkspace(models.WorkspaceSettings{
+				Name:   "ws",
+				Stores: &[]models.Stores{{Block: []models.BlockStore{store}}},
+			}, cfg, PosixIdentity{}, nil)
+			return err
+		}
+
+		assert.NoError(t, build(models.BlockStore{Name: "home", Size: "500Mi", StorageClass: "fast.ssd"}), provider)
+
+		// Overrides the controller could not reconcile fail the message for good
+		err := build(models.BlockStore{Name: "home", Size: "10 gigs"})
+		assert.ErrorContains(t, err, `size "10 gigs"`, provider)
+		assert.True(t, IsPermanent(err), provider)
+
+		err = build(models.BlockStore{Name: "home", StorageClass: "Fast SSD"})
+		assert.ErrorContains(t, err, `storage class "Fast SSD"`, provider)
+		assert.True(t, IsPermanent(err), provider)
+	}
+}
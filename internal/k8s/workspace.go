@@ -3,63 +3,243 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"strings"
+	"unicode"
 
 	workspacev1alpha1 "github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
 	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
 	"github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/rs/zerolog/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// MapObjectStoresToS3Buckets maps ObjectStores to S3Buckets
-func MapObjectStoresToS3Buckets(workspaceName string, c *utils.Config, objectStores []models.ObjectStore) []workspacev1alpha1.S3Bucket {
+// workspaceResource identifies Workspaces in API errors
+var workspaceResource = workspacev1alpha1.GroupVersion.WithResource("workspaces").GroupResource()
+
+// defaultS3EnvVar is the environment variable used for an object store that does not specify one
+const defaultS3EnvVar = "S3_BUCKET_WORKSPACE"
+
+// MapObjectStoresToS3Buckets maps ObjectStores to S3Buckets. Values in the store take precedence,
+// with the cluster configuration used as a fallback. The existing Workspace, if any, is used to keep
+// access point names that were assigned before they included the store name.
+func MapObjectStoresToS3Buckets(req models.WorkspaceSettings, c *utils.Config, objectStores []models.ObjectStore, existing *workspacev1alpha1.Workspace) ([]workspacev1alpha1.S3Bucket, error) {
+	buckets, err := mapObjectStores(objectStores, c.AWS.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, obj := range objectStores {
+		accessPointName := accessPointNameFromArn(obj.AccessPointArn)
+		if accessPointName == "" {
+			data := namingData(req, c, obj, i)
+			data.Legacy = true
+			legacyName, err := c.Naming.Render(utils.NamingS3AccessPoint, data)
+			if err != nil {
+				return nil, err
+			}
+			accessPointName = legacyName
+
+			legacy := buckets[i]
+			legacy.AccessPointName = legacyName
+			if !hasS3Bucket(existing, legacy) {
+				data.Legacy = false
+				if accessPointName, err = c.Naming.Render(utils.NamingS3AccessPoint, data); err != nil {
+					return nil, err
+				}
+			}
+		}
+		buckets[i].AccessPointName = accessPointName
+	}
+
+	return buckets, nil
+}
+
+// mapObjectStores maps ObjectStores to S3Buckets with the bucket, path and environment variable
+// shared by every storage provider. Stores without a bucket use defaultBucket and stores without a
+// prefix use their name.
+func mapObjectStores(objectStores []models.ObjectStore, defaultBucket string) ([]workspacev1alpha1.S3Bucket, error) {
+	envVars, err := objectStoreEnvVars(objectStores)
+	if err != nil {
+		return nil, err
+	}
+
 	var buckets []workspacev1alpha1.S3Bucket
-	for _, obj := range objectStores {
+	for i, obj := range objectStores {
+		bucket := obj.Bucket
+		if bucket == "" {
+			bucket = defaultBucket
+		}
+
+		path := obj.Prefix
+		if path == "" {
+			path = fmt.Sprintf("%s/", obj.Name)
+		}
+
 		buckets = append(buckets, workspacev1alpha1.S3Bucket{
-			Name:            c.AWS.Bucket,
-			Path:            fmt.Sprintf("%s/", obj.Name),
-			EnvVar:          "S3_BUCKET_WORKSPACE",
-			AccessPointName: fmt.Sprintf("%s-%s-s3", c.AWS.Cluster, workspaceName),
+			Name:   bucket,
+			Path:   path,
+			EnvVar: envVars[i],
 		})
 	}
+	return buckets, nil
+}
+
+// hasS3Bucket reports whether the existing Workspace, if any, already has the bucket with the same
+// path and access point
+func hasS3Bucket(existing *workspacev1alpha1.Workspace, bucket workspacev1alpha1.S3Bucket) bool {
+	if existing == nil {
+		return false
+	}
+	for _, b := range existing.Spec.AWS.S3.Buckets {
+		if b.Name == bucket.Name && b.Path == bucket.Path && b.AccessPointName == bucket.AccessPointName {
+			return true
+		}
+	}
+	return false
+}
+
+// objectStoreEnvVars returns the environment variable for each object store. The first store
+// without one gets the default, and any further stores without one get the default suffixed with
+// the store name. It fails if two stores would set the same variable.
+func objectStoreEnvVars(objectStores []models.ObjectStore) ([]string, error) {
+	envVars := make([]string, len(objectStores))
+	owners := make(map[string]string)
+	defaultUsed := false
+	for i, obj := range objectStores {
+		envVar := obj.EnvVar
+		if envVar == "" {
+			envVar = defaultS3EnvVar
+			if defaultUsed {
+				envVar = fmt.Sprintf("%s_%s", defaultS3EnvVar, envVarSuffix(obj.Name))
+			}
+			defaultUsed = true
+		}
+
+		if owner, ok := owners[envVar]; ok {
+			return nil, fmt.Errorf("object stores %q and %q both use environment variable %s", owner, obj.Name, envVar)
+		}
+		owners[envVar] = obj.Name
+		envVars[i] = envVar
+	}
+	return envVars, nil
+}
 
-	return buckets
+// envVarSuffix converts a store name to upper case, replacing anything other than letters and
+// digits with underscores
+func envVarSuffix(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
+
+// accessPointNameFromArn extracts the access point name from an S3 access point ARN of the form
+// arn:aws:s3:<region>:<account>:accesspoint/<name>
+func accessPointNameFromArn(arn string) string {
+	if _, name, ok := strings.Cut(arn, ":accesspoint/"); ok {
+		return name
+	}
+	return ""
 }
 
-// MapBlockStoresToEFSAccessPoints maps BlockStores to EFSAccessPoints
-func MapBlockStoresToEFSAccessPoints(workspaceName string, c *utils.Config, blockStores []models.BlockStore) []workspacev1alpha1.EFSAccess {
+// MapBlockStoresToEFSAccessPoints maps BlockStores to EFSAccessPoints owned by the workspace's
+// identity. Permissions can be overridden per block store.
+func MapBlockStoresToEFSAccessPoints(req models.WorkspaceSettings, c *utils.Config, blockStores []models.BlockStore, identity PosixIdentity) ([]workspacev1alpha1.EFSAccess, error) {
 	var accessPoints []workspacev1alpha1.EFSAccess
-	for _, block := range blockStores {
+	for i, block := range blockStores {
+		rootDirectory, err := c.Naming.Render(utils.NamingEFSRootDirectory, namingData(req, c, block, i))
+		if err != nil {
+			return nil, err
+		}
+
+		permissions := c.Storage.Permissions
+		if block.Permissions != "" {
+			if !utils.IsPermissions(block.Permissions) {
+				return nil, fmt.Errorf("block store %s permissions %q is not an octal mode such as 755", block.Name, block.Permissions)
+			}
+			permissions = block.Permissions
+		}
+
 		accessPoints = append(accessPoints, workspacev1alpha1.EFSAccess{
 			Name:          block.Name,
 			FSID:          c.AWS.FSID,
-			RootDirectory: fmt.Sprintf("/workspaces/%s", block.Name),
+			RootDirectory: rootDirectory,
 			User: workspacev1alpha1.User{
-				UID: 1000, // Default UID
-				GID: 1000, // Default GID
+				UID: identity.UID,
+				GID: identity.GID,
 			},
-			Permissions: "755", // Default permissions
+			Permissions: permissions,
 		})
 	}
-	return accessPoints
+	return accessPoints, nil
 }
 
-// GenerateStorageConfig generates a StorageSpec for a Workspace based on the workspace name
-func GenerateStorageConfig(workspaceName string, c *utils.Config, efsAccessPoints []workspacev1alpha1.EFSAccess) workspacev1alpha1.StorageSpec {
+// blockStoreVolume returns the size and storage class of a block store's volume, defaulting to
+// storage.size and storage.storageClass. Overrides from the settings message are checked like the
+// configured values so that the controller is never given a Workspace it cannot reconcile.
+func blockStoreVolume(store models.BlockStore, c *utils.Config) (size, storageClass string, err error) {
+	size = c.Storage.Size
+	if store.Size != "" {
+		if _, err := resource.ParseQuantity(store.Size); err != nil {
+			return "", "", fmt.Errorf("block store %s size %q is not a valid quantity: %w", store.Name, store.Size, err)
+		}
+		size = store.Size
+	}
+
+	storageClass = c.Storage.StorageClass
+	if store.StorageClass != "" {
+		if msgs := validation.IsDNS1123Subdomain(store.StorageClass); len(msgs) > 0 {
+			return "", "", fmt.Errorf("block store %s storage class %q is not a valid name: %s", store.Name, store.StorageClass, strings.Join(msgs, ", "))
+		}
+		storageClass = store.StorageClass
+	}
+	return size, storageClass, nil
+}
+
+// GenerateStorageConfig generates a StorageSpec for a Workspace with a PV and PVC for each block
+// store. Size and storage class can be overridden per block store. The existing Workspace, if any,
+// is used to keep PV and PVC names that were assigned before they included the store name.
+func GenerateStorageConfig(req models.WorkspaceSettings, c *utils.Config, blockStores []models.BlockStore, existing *workspacev1alpha1.Workspace) (workspacev1alpha1.StorageSpec, error) {
 	var pvs []workspacev1alpha1.PVSpec
 	var pvcs []workspacev1alpha1.PVCSpec
 
-	for _, blockStore := range efsAccessPoints {
+	for i, blockStore := range blockStores {
 
-		pvName := fmt.Sprintf("pv-%s", workspaceName)
-		pvcName := fmt.Sprintf("pvc-%s", workspaceName)
+		// The store whose PV already has the legacy name keeps it, and its PVC, wherever it is
+		// in the list
+		data := namingData(req, c, blockStore, i)
+		data.Legacy = true
+		legacyPVName, err := c.Naming.Render(utils.NamingPVName, data)
+		if err != nil {
+			return workspacev1alpha1.StorageSpec{}, err
+		}
+		data.Legacy = hasPV(existing, legacyPVName, blockStore.Name)
+
+		pvName, err := c.Naming.Render(utils.NamingPVName, data)
+		if err != nil {
+			return workspacev1alpha1.StorageSpec{}, err
+		}
+		pvcName, err := c.Naming.Render(utils.NamingPVCName, data)
+		if err != nil {
+			return workspacev1alpha1.StorageSpec{}, err
+		}
+
+		size, storageClass, err := blockStoreVolume(blockStore, c)
+		if err != nil {
+			return workspacev1alpha1.StorageSpec{}, err
+		}
 
 		// Persistent Volume Specification
 		pvs = append(pvs, workspacev1alpha1.PVSpec{
 			Name:         pvName,
-			StorageClass: c.Storage.StorageClass,
-			Size:         c.Storage.Size,
+			StorageClass: storageClass,
+			Size:         size,
 			VolumeSource: &workspacev1alpha1.VolumeSource{
 				Driver:          c.Storage.Driver,
 				AccessPointName: blockStore.Name,
@@ -70,8 +250,8 @@ func GenerateStorageConfig(workspaceName string, c *utils.Config, efsAccessPoint
 		pvcs = append(pvcs, workspacev1alpha1.PVCSpec{
 			PVSpec: workspacev1alpha1.PVSpec{
 				Name:         pvcName,
-				StorageClass: c.Storage.StorageClass,
-				Size:         c.Storage.Size,
+				StorageClass: storageClass,
+				Size:         size,
 			},
 			PVName: pvName,
 		})
@@ -80,106 +260,225 @@ func GenerateStorageConfig(workspaceName string, c *utils.Config, efsAccessPoint
 	return workspacev1alpha1.StorageSpec{
 		PersistentVolumes:      pvs,
 		PersistentVolumeClaims: pvcs,
+	}, nil
+}
+
+// hasPV reports whether the existing Workspace, if any, already has the named PV for the block
+// store
+func hasPV(existing *workspacev1alpha1.Workspace, name, blockStore string) bool {
+	if existing == nil {
+		return false
 	}
+	for _, pv := range existing.Spec.Storage.PersistentVolumes {
+		if pv.Name == name && pv.VolumeSource != nil && pv.VolumeSource.AccessPointName == blockStore {
+			return true
+		}
+	}
+	return false
 }
 
-// buildWorkspace creates a Workspace object based on the provided WorkspaceSettings
-func buildWorkspace(req models.WorkspaceSettings, c *utils.Config) *workspacev1alpha1.Workspace {
-	var s3Buckets []workspacev1alpha1.S3Bucket
-	var efsAccessPoints []workspacev1alpha1.EFSAccess
+// namingData returns the data the naming templates are rendered against for a store. Legacy is
+// left unset for the caller to decide.
+func namingData(req models.WorkspaceSettings, c *utils.Config, store any, i int) utils.NamingData {
+	return utils.NamingData{
+		Workspace: req,
+		Store:     store,
+		Index:     i,
+		AWS:       c.AWS,
+	}
+}
 
-	if req.Stores != nil {
-		for _, store := range *req.Stores {
-			// Map ObjectStores to S3Buckets
-			s3Buckets = append(s3Buckets, MapObjectStoresToS3Buckets(req.Name, c, store.Object)...)
-			// Map BlockStores to EFSAccessPoints
-			efsAccessPoints = append(efsAccessPoints, MapBlockStoresToEFSAccessPoints(req.Name, c, store.Block)...)
-		}
+// BuildWorkspace creates a Workspace object based on the provided WorkspaceSettings, with the
+// stores mapped by the configured storage provider. It only depends on its arguments, so its
+// errors are permanent.
+func BuildWorkspace(req models.WorkspaceSettings, c *utils.Config, identity PosixIdentity, existing *workspacev1alpha1.Workspace) (*workspacev1alpha1.Workspace, error) {
+	provider, err := NewStorageProvider(c.Storage.Provider)
+	if err != nil {
+		return nil, permanent(err)
+	}
+
+	// Workspace level names
+	namespace, err := c.Naming.Render(utils.NamingNamespace, namingData(req, c, nil, 0))
+	if err != nil {
+		return nil, permanent(err)
 	}
 
-	// Generate storage configuration based on workspace name
-	storageConfig := GenerateStorageConfig(req.Name, c, efsAccessPoints)
+	spec := workspacev1alpha1.WorkspaceSpec{
+		Namespace: namespace,
+		ServiceAccount: workspacev1alpha1.ServiceAccountSpec{
+			Name: "default",
+		},
+	}
+	if err := provider.MapStores(req, c, identity, existing, &spec); err != nil {
+		return nil, permanent(err)
+	}
 
-	// Create the Workspace object
+	// Create the Workspace object. The type information is required for server-side apply
 	return &workspacev1alpha1.Workspace{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: workspacev1alpha1.GroupVersion.String(),
+			Kind:       "Workspace",
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      req.Name,
-			Namespace: "workspaces",
+			Namespace: c.Kubernetes.Namespace,
 			Labels: map[string]string{
 				"app.kubernetes.io/name": "workspace-operator",
 			},
 		},
-		Spec: workspacev1alpha1.WorkspaceSpec{
-			Namespace: "ws-" + req.Name,
-			AWS: workspacev1alpha1.AWSSpec{
-				RoleName: fmt.Sprintf("%s-%s", c.AWS.Cluster, req.Name),
-				EFS: workspacev1alpha1.EFSSpec{
-					AccessPoints: efsAccessPoints,
-				},
-				S3: workspacev1alpha1.S3Spec{
-					Buckets: s3Buckets,
-				},
-			},
-			ServiceAccount: workspacev1alpha1.ServiceAccountSpec{
-				Name: "default",
-			},
-			Storage: storageConfig,
-		},
-	}
+		Spec: spec,
+	}, nil
 }
 
-// CreateWorkspace creates a new Workspace in the cluster
+// CreateWorkspace creates a new Workspace in the cluster, failing if it already exists. It is
+// written with server-side apply so that the manager owns its fields as it does after an update.
 func CreateWorkspace(ctx context.Context, k8sClient client.Client, req models.WorkspaceSettings, c *utils.Config) error {
-	workspace := buildWorkspace(req, c)
+	// Check the Workspace does not exist so that a create never modifies one
+	err := k8sClient.Get(ctx, client.ObjectKey{Name: req.Name, Namespace: c.Kubernetes.Namespace}, &workspacev1alpha1.Workspace{})
+	if err == nil {
+		return fmt.Errorf("failed to create workspace %s: %w", req.Name, apierrors.NewAlreadyExists(workspaceResource, req.Name))
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to fetch workspace %s: %w", req.Name, err)
+	}
 
-	err := k8sClient.Create(ctx, workspace)
+	identity, err := AllocateIdentity(ctx, k8sClient, c, req.Name)
 	if err != nil {
+		return err
+	}
+
+	workspace, err := BuildWorkspace(req, c, identity, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build workspace %s: %w", req.Name, err)
+	}
+
+	if err := applyWorkspace(ctx, k8sClient, workspace, c); err != nil {
 		return fmt.Errorf("failed to create workspace %s: %w", req.Name, err)
 	}
 
-	log.Info().Str("name", req.Name).Str("namespace", req.Name).Msg("Workspace successfully created")
+	log.Info().Str("name", req.Name).Str("namespace", c.Kubernetes.Namespace).Msg("Workspace successfully created")
 	return nil
 }
 
 // UpdateWorkspace updates an existing Workspace in the cluster
 func UpdateWorkspace(ctx context.Context, k8sClient client.Client, req models.WorkspaceSettings, c *utils.Config) error {
 
-	// Retrieve the existing Workspace from the cluster
-	existingWorkspace := &workspacev1alpha1.Workspace{}
-	err := k8sClient.Get(ctx, client.ObjectKey{Name: req.Name, Namespace: "workspaces"}, existingWorkspace)
+	identity, err := AllocateIdentity(ctx, k8sClient, c, req.Name)
 	if err != nil {
-		return fmt.Errorf("failed to fetch workspace %s: %w", req.Name, err)
+		return err
 	}
 
-	// Build the updated Workspace
-	updatedWorkspace := buildWorkspace(req, c)
+	err = retryOnConflict(req.Name, c, func() error {
+		// Check the Workspace exists so that an update never creates one
+		existingWorkspace := &workspacev1alpha1.Workspace{}
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: req.Name, Namespace: c.Kubernetes.Namespace}, existingWorkspace)
+		if err != nil {
+			return fmt.Errorf("failed to fetch workspace %s: %w", req.Name, err)
+		}
 
-	// Set the ResourceVersion to ensure the update is successful
-	updatedWorkspace.ObjectMeta.ResourceVersion = existingWorkspace.ObjectMeta.ResourceVersion
+		// Apply the fields derived from the settings, leaving fields owned by others untouched
+		workspace, err := BuildWorkspace(req, c, identity, existingWorkspace)
+		if err != nil {
+			return fmt.Errorf("failed to build workspace %s: %w", req.Name, err)
+		}
+		if err := applyWorkspace(ctx, k8sClient, workspace, c); err != nil {
+			return fmt.Errorf("failed to update workspace %s: %w", req.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-	// Perform the update operation
-	err = k8sClient.Update(ctx, updatedWorkspace)
+	log.Info().Str("name", req.Name).Str("namespace", c.Kubernetes.Namespace).Msg("Workspace successfully updated")
+	return nil
+}
+
+// CreateOrUpdateWorkspace creates the Workspace if it does not exist and updates it otherwise, so
+// that redelivered or out of order messages converge on the same result
+func CreateOrUpdateWorkspace(ctx context.Context, k8sClient client.Client, req models.WorkspaceSettings, c *utils.Config) error {
+	identity, err := AllocateIdentity(ctx, k8sClient, c, req.Name)
 	if err != nil {
-		return fmt.Errorf("failed to update workspace %s: %w", req.Name, err)
+		return err
 	}
 
-	log.Info().Str("name", req.Name).Str("namespace", req.Name).Msg("Workspace successfully updated")
+	err = retryOnConflict(req.Name, c, func() error {
+		// The existing Workspace, if any, decides which names its stores keep
+		existingWorkspace := &workspacev1alpha1.Workspace{}
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: req.Name, Namespace: c.Kubernetes.Namespace}, existingWorkspace)
+		if apierrors.IsNotFound(err) {
+			existingWorkspace = nil
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch workspace %s: %w", req.Name, err)
+		}
+
+		workspace, err := BuildWorkspace(req, c, identity, existingWorkspace)
+		if err != nil {
+			return fmt.Errorf("failed to build workspace %s: %w", req.Name, err)
+		}
+		return applyWorkspace(ctx, k8sClient, workspace, c)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply workspace %s: %w", req.Name, err)
+	}
+
+	log.Info().Str("name", req.Name).Str("namespace", c.Kubernetes.Namespace).Msg("Workspace successfully applied")
 	return nil
 }
 
+// applyWorkspace writes the workspace with server-side apply under the configured field manager,
+// so the manager only owns the fields it sets. The apply has no resource version precondition, so
+// status writes by the controller in the meantime do not make it fail.
+func applyWorkspace(ctx context.Context, k8sClient client.Client, workspace *workspacev1alpha1.Workspace, c *utils.Config) error {
+	opts := []client.PatchOption{client.FieldOwner(c.Kubernetes.FieldManager)}
+	if c.Kubernetes.ForceOwnership {
+		opts = append(opts, client.ForceOwnership)
+	}
+
+	err := k8sClient.Patch(ctx, workspace, client.Apply, opts...)
+	if isFieldManagerConflict(err) {
+		return fmt.Errorf("fields are owned by another field manager, set kubernetes.forceOwnership to take ownership: %w", err)
+	}
+	return err
+}
+
+// GetWorkspace fetches a Workspace from the cluster
+func GetWorkspace(ctx context.Context, k8sClient client.Client, name string, c *utils.Config) (*workspacev1alpha1.Workspace, error) {
+	workspace := &workspacev1alpha1.Workspace{}
+	err := k8sClient.Get(ctx, client.ObjectKey{Name: name, Namespace: c.Kubernetes.Namespace}, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch workspace %s: %w", name, err)
+	}
+	return workspace, nil
+}
+
+// ListWorkspaces lists the Workspaces in the configured namespace
+func ListWorkspaces(ctx context.Context, k8sClient client.Client, c *utils.Config) ([]workspacev1alpha1.Workspace, error) {
+	workspaces := &workspacev1alpha1.WorkspaceList{}
+	err := k8sClient.List(ctx, workspaces, client.InNamespace(c.Kubernetes.Namespace))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	return workspaces.Items, nil
+}
+
 // DeleteWorkspace deletes an existing Workspace in the cluster
-func DeleteWorkspace(ctx context.Context, k8sClient client.Client, payload models.WorkspaceSettings) error {
+func DeleteWorkspace(ctx context.Context, k8sClient client.Client, payload models.WorkspaceSettings, c *utils.Config) error {
 
 	// Define the workspace to delete
 	workspace := &workspacev1alpha1.Workspace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      payload.Name,
-			Namespace: "workspaces",
+			Namespace: c.Kubernetes.Namespace,
 		},
 	}
 
 	// Attempt to delete the workspace
 	err := k8sClient.Delete(ctx, workspace)
+	if apierrors.IsNotFound(err) {
+		log.Info().Str("name", payload.Name).Msg("Workspace already deleted")
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete workspace %s: %w", payload.Name, err)
 	}
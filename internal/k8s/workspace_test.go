@@ -5,22 +5,26 @@ import (
 	"testing"
 
 	"github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/k8s/k8stest"
 	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
 	"github.com/EO-DataHub/eodhp-workspace-manager/models"
 	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 )
 
 func TestCreateWorkspace(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = v1alpha1.AddToScheme(scheme)
 
-	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
 
 	ctx := context.Background()
 	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
 		AWS: utils.AWSConfig{
 			Bucket:  "test-bucket",
 			Cluster: "test-cluster",
@@ -55,14 +59,63 @@ func TestCreateWorkspace(t *testing.T) {
 	assert.Equal(t, "ws-test-ws", created.Spec.Namespace)
 }
 
+func TestApplyWorkspaceOptions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	// Record the options and object sent with each apply
+	var applied []*client.PatchOptions
+	var objects []*v1alpha1.Workspace
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			applied = append(applied, (&client.PatchOptions{}).ApplyOptions(opts))
+			objects = append(objects, obj.DeepCopyObject().(*v1alpha1.Workspace))
+			return k8stest.ServerSideApply(ctx, c, obj, patch, opts...)
+		},
+	}).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "staging-manager"}}
+	payload := models.WorkspaceSettings{Name: "owned-ws", Status: "creating"}
+	assert.NoError(t, CreateWorkspace(ctx, fakeClient, payload, cfg))
+
+	// Another manager labels the workspace
+	existing := &v1alpha1.Workspace{}
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "owned-ws", Namespace: "workspaces"}, existing))
+	existing.Labels["team"] = "platform"
+	existing.Annotations = map[string]string{"note": "keep"}
+	assert.NoError(t, fakeClient.Update(ctx, existing))
+
+	assert.NoError(t, UpdateWorkspace(ctx, fakeClient, payload, cfg))
+	cfg.Kubernetes.ForceOwnership = true
+	assert.NoError(t, CreateOrUpdateWorkspace(ctx, fakeClient, payload, cfg))
+
+	// Every write is an apply under the configured field manager, forced only when configured
+	assert.Len(t, applied, 3)
+	for i, opts := range applied {
+		assert.Equal(t, "staging-manager", opts.FieldManager)
+		assert.Equal(t, i == 2, opts.Force != nil && *opts.Force)
+	}
+
+	// Only the fields the manager derives are applied, so fields owned by others are left alone
+	for _, obj := range objects {
+		assert.Equal(t, map[string]string{"app.kubernetes.io/name": "workspace-operator"}, obj.Labels)
+		assert.Empty(t, obj.Annotations)
+	}
+
+	// A workspace that already exists is not created again
+	assert.True(t, apierrors.IsAlreadyExists(CreateWorkspace(ctx, fakeClient, payload, cfg)))
+}
+
 func TestUpdateWorkspace(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = v1alpha1.AddToScheme(scheme)
 
-	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
 	ctx := context.Background()
 
 	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
 		AWS: utils.AWSConfig{
 			Bucket:  "bucket",
 			Cluster: "cluster",
@@ -107,13 +160,40 @@ func TestUpdateWorkspace(t *testing.T) {
 	assert.Equal(t, "update-ws", updated.Name)
 }
 
+func TestUpdateWorkspaceNotFound(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
+	ctx := context.Background()
+
+	err := UpdateWorkspace(ctx, fakeClient, models.WorkspaceSettings{Name: "missing-ws", Status: "updating"}, &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+	})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// An update must never create the workspace
+	getErr := fakeClient.Get(ctx, client.ObjectKey{Name: "missing-ws", Namespace: "workspaces"}, &v1alpha1.Workspace{})
+	assert.True(t, apierrors.IsNotFound(getErr))
+}
+
 func TestDeleteWorkspace(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = v1alpha1.AddToScheme(scheme)
 
-	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
 	ctx := context.Background()
 
+	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+		AWS:        utils.AWSConfig{Bucket: "bucket", Cluster: "cluster", FSID: "fsid"},
+		Storage: utils.StorageConfig{
+			Driver:       "efs",
+			StorageClass: "sc",
+			Size:         "5Gi",
+		},
+	}
+
 	// Pre-create workspace
 	createErr := CreateWorkspace(ctx, fakeClient, models.WorkspaceSettings{
 		Name: "delete-ws",
@@ -123,22 +203,249 @@ func TestDeleteWorkspace(t *testing.T) {
 				Object: []models.ObjectStore{{Name: "object"}},
 			},
 		},
-	}, &utils.Config{
-		AWS: utils.AWSConfig{Bucket: "bucket", Cluster: "cluster", FSID: "fsid"},
-		Storage: utils.StorageConfig{
-			Driver:       "efs",
-			StorageClass: "sc",
-			Size:         "5Gi",
-		},
-	})
+	}, cfg)
 	assert.NoError(t, createErr)
 
 	err := DeleteWorkspace(ctx, fakeClient, models.WorkspaceSettings{
 		Name: "delete-ws",
-	})
+	}, cfg)
 	assert.NoError(t, err)
 
 	deleted := &v1alpha1.Workspace{}
 	getErr := fakeClient.Get(ctx, client.ObjectKey{Name: "delete-ws", Namespace: "workspaces"}, deleted)
 	assert.Error(t, getErr) // Should not find the object anymore
 }
+
+func TestGetAndListWorkspaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"}}
+	other := &utils.Config{Kubernetes: utils.KubernetesConfig{Namespace: "other", FieldManager: "workspace-manager"}}
+
+	assert.NoError(t, CreateWorkspace(ctx, fakeClient, models.WorkspaceSettings{Name: "ws-a"}, cfg))
+	assert.NoError(t, CreateWorkspace(ctx, fakeClient, models.WorkspaceSettings{Name: "ws-b"}, cfg))
+	assert.NoError(t, CreateWorkspace(ctx, fakeClient, models.WorkspaceSettings{Name: "ws-c"}, other))
+
+	workspace, err := GetWorkspace(ctx, fakeClient, "ws-a", cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "ws-ws-a", workspace.Spec.Namespace)
+
+	_, err = GetWorkspace(ctx, fakeClient, "ws-c", cfg)
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// Only Workspaces in the configured namespace are listed
+	workspaces, err := ListWorkspaces(ctx, fakeClient, cfg)
+	assert.NoError(t, err)
+	assert.Len(t, workspaces, 2)
+}
+
+func TestProcessWorkspaceIsIdempotent(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+		AWS:        utils.AWSConfig{Bucket: "bucket", Cluster: "cluster", FSID: "fsid"},
+		Storage: utils.StorageConfig{
+			Driver:       "efs",
+			StorageClass: "sc",
+			Size:         "5Gi",
+		},
+	}
+
+	payload := models.WorkspaceSettings{
+		Name: "idempotent-ws",
+		Stores: &[]models.Stores{
+			{
+				Block: []models.BlockStore{{Name: "block"}},
+			},
+		},
+	}
+
+	// An update for a workspace that was never created should create it
+	payload.Status = "updating"
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, false))
+
+	// A redelivered create should update the existing workspace
+	payload.Status = "creating"
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, false))
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, false))
+
+	existing := &v1alpha1.Workspace{}
+	err := fakeClient.Get(ctx, client.ObjectKey{Name: "idempotent-ws", Namespace: "workspaces"}, existing)
+	assert.NoError(t, err)
+	assert.Equal(t, "ws-idempotent-ws", existing.Spec.Namespace)
+
+	// Deleting twice should succeed both times
+	payload.Status = "deleting"
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, false))
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, false))
+}
+
+func TestMapObjectStoresToS3Buckets(t *testing.T) {
+	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+		AWS:        utils.AWSConfig{Bucket: "default-bucket", Cluster: "cluster"},
+	}
+
+	stores := []models.ObjectStore{
+		{Name: "first"},
+		{Name: "second-store"},
+		{
+			Name:           "custom",
+			Bucket:         "other-bucket",
+			Prefix:         "data/custom/",
+			EnvVar:         "S3_CUSTOM",
+			AccessPointArn: "arn:aws:s3:eu-west-2:123456789012:accesspoint/custom-ap",
+		},
+	}
+	buckets, err := MapObjectStoresToS3Buckets(models.WorkspaceSettings{Name: "ws"}, cfg, stores, nil)
+	assert.NoError(t, err)
+
+	// Each store gets its own access point
+	assert.Equal(t, []v1alpha1.S3Bucket{
+		{Name: "default-bucket", Path: "first/", EnvVar: "S3_BUCKET_WORKSPACE", AccessPointName: "cluster-ws-first-s3"},
+		{Name: "default-bucket", Path: "second-store/", EnvVar: "S3_BUCKET_WORKSPACE_SECOND_STORE", AccessPointName: "cluster-ws-second-store-s3"},
+		{Name: "other-bucket", Path: "data/custom/", EnvVar: "S3_CUSTOM", AccessPointName: "custom-ap"},
+	}, buckets)
+
+	// A store that already has the access point named before stores were included keeps it,
+	// wherever it is in the list
+	existing := &v1alpha1.Workspace{Spec: v1alpha1.WorkspaceSpec{AWS: v1alpha1.AWSSpec{S3: v1alpha1.S3Spec{Buckets: []v1alpha1.S3Bucket{
+		{Name: "default-bucket", Path: "second-store/", EnvVar: "S3_BUCKET_WORKSPACE", AccessPointName: "cluster-ws-s3"},
+	}}}}}
+	buckets, err = MapObjectStoresToS3Buckets(models.WorkspaceSettings{Name: "ws"}, cfg, stores, existing)
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster-ws-first-s3", buckets[0].AccessPointName)
+	assert.Equal(t, "cluster-ws-s3", buckets[1].AccessPointName)
+}
+
+func TestObjectStoreEnvVarsMustBeUnique(t *testing.T) {
+	for name, stores := range map[string][]models.ObjectStore{
+		"explicit":            {{Name: "a", EnvVar: "S3_DATA"}, {Name: "b", EnvVar: "S3_DATA"}},
+		"explicit default":    {{Name: "a", EnvVar: "S3_BUCKET_WORKSPACE"}, {Name: "b"}},
+		"explicit generated":  {{Name: "a"}, {Name: "b"}, {Name: "c", EnvVar: "S3_BUCKET_WORKSPACE_B"}},
+		"same suffix":         {{Name: "first"}, {Name: "a-b"}, {Name: "a_b"}},
+		"generated explicit":  {{Name: "a"}, {Name: "b", EnvVar: "S3_BUCKET_WORKSPACE_C"}, {Name: "c"}},
+		"default after named": {{Name: "a"}, {Name: "b", EnvVar: "S3_BUCKET_WORKSPACE"}},
+	} {
+		_, err := objectStoreEnvVars(stores)
+		assert.Error(t, err, name)
+	}
+
+	envVars, err := objectStoreEnvVars([]models.ObjectStore{{Name: "a", EnvVar: "S3_DATA"}, {Name: "b"}, {Name: "c"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"S3_DATA", "S3_BUCKET_WORKSPACE", "S3_BUCKET_WORKSPACE_C"}, envVars)
+}
+
+func TestGenerateStorageConfig(t *testing.T) {
+	cfg := &utils.Config{
+		Storage: utils.StorageConfig{
+			Driver:       "efs",
+			StorageClass: "standard",
+			Size:         "10Gi",
+		},
+	}
+
+	blockStores := []models.BlockStore{
+		{Name: "data"},
+		{Name: "scratch", Size: "50Gi", StorageClass: "fast"},
+	}
+	storage, err := GenerateStorageConfig(models.WorkspaceSettings{Name: "ws"}, cfg, blockStores, nil)
+	assert.NoError(t, err)
+
+	// Every block store gets names of its own
+	assert.Len(t, storage.PersistentVolumes, 2)
+	assert.Equal(t, "pv-ws-data", storage.PersistentVolumes[0].Name)
+	assert.Equal(t, "pvc-ws-data", storage.PersistentVolumeClaims[0].Name)
+	assert.Equal(t, "pv-ws-data", storage.PersistentVolumeClaims[0].PVName)
+	assert.Equal(t, "10Gi", storage.PersistentVolumes[0].Size)
+	assert.Equal(t, "standard", storage.PersistentVolumes[0].StorageClass)
+	assert.Equal(t, "data", storage.PersistentVolumes[0].VolumeSource.AccessPointName)
+
+	assert.Equal(t, "pv-ws-scratch", storage.PersistentVolumes[1].Name)
+	assert.Equal(t, "pvc-ws-scratch", storage.PersistentVolumeClaims[1].Name)
+	assert.Equal(t, "pv-ws-scratch", storage.PersistentVolumeClaims[1].PVName)
+	assert.Equal(t, "50Gi", storage.PersistentVolumeClaims[1].Size)
+	assert.Equal(t, "fast", storage.PersistentVolumeClaims[1].StorageClass)
+	assert.Equal(t, "scratch", storage.PersistentVolumes[1].VolumeSource.AccessPointName)
+
+	// The store that already has the single-store names keeps them, even once another store is
+	// listed before it
+	existing := &v1alpha1.Workspace{Spec: v1alpha1.WorkspaceSpec{Storage: v1alpha1.StorageSpec{
+		PersistentVolumes: []v1alpha1.PVSpec{
+			{Name: "pv-ws", VolumeSource: &v1alpha1.VolumeSource{AccessPointName: "scratch"}},
+		},
+	}}}
+	storage, err = GenerateStorageConfig(models.WorkspaceSettings{Name: "ws"}, cfg, blockStores, existing)
+	assert.NoError(t, err)
+	assert.Equal(t, "pv-ws-data", storage.PersistentVolumes[0].Name)
+	assert.Equal(t, "pvc-ws-data", storage.PersistentVolumeClaims[0].Name)
+	assert.Equal(t, "pv-ws", storage.PersistentVolumes[1].Name)
+	assert.Equal(t, "pvc-ws", storage.PersistentVolumeClaims[1].Name)
+	assert.Equal(t, "pv-ws", storage.PersistentVolumeClaims[1].PVName)
+
+	// Removing it does not give its names to another store
+	storage, err = GenerateStorageConfig(models.WorkspaceSettings{Name: "ws"}, cfg, blockStores[:1], existing)
+	assert.NoError(t, err)
+	assert.Equal(t, "pv-ws-data", storage.PersistentVolumes[0].Name)
+}
+
+func TestBuildWorkspaceNamingTemplates(t *testing.T) {
+	cfg := &utils.Config{
+		Kubernetes: utils.KubernetesConfig{Namespace: "workspaces", FieldManager: "workspace-manager"},
+		AWS:        utils.AWSConfig{Cluster: "cluster", FSID: "fsid"},
+		Naming: utils.NamingConfig{
+			Namespace:        "workspace-{{.Workspace.Name}}",
+			RoleName:         "{{.AWS.Cluster}}-role-{{.Workspace.Name}}",
+			EFSRootDirectory: "/data/{{.Workspace.Name}}/{{.Store.Name}}",
+		},
+	}
+
+	workspace, err := BuildWorkspace(models.WorkspaceSettings{
+		Name: "demo",
+		Stores: &[]models.Stores{
+			{Block: []models.BlockStore{{Name: "block"}}},
+		},
+	}, cfg, PosixIdentity{}, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "workspace-demo", workspace.Spec.Namespace)
+	assert.Equal(t, "cluster-role-demo", workspace.Spec.AWS.RoleName)
+	assert.Equal(t, "/data/demo/block", workspace.Spec.AWS.EFS.AccessPoints[0].RootDirectory)
+
+	// Templates that are not configured keep their defaults
+	assert.Equal(t, "pv-demo-block", workspace.Spec.Storage.PersistentVolumes[0].Name)
+
+	// Rendering fails for templates that reference unknown fields
+	cfg.Naming.RoleName = "{{.Workspace.Missing}}"
+	_, err = BuildWorkspace(models.WorkspaceSettings{Name: "demo"}, cfg, PosixIdentity{}, nil)
+	assert.Error(t, err)
+	assert.True(t, IsPermanent(err))
+}
+
+func TestWorkspaceNamespaceFromConfig(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(k8stest.Interceptor).Build()
+	ctx := context.Background()
+
+	cfg := &utils.Config{Kubernetes: utils.KubernetesConfig{Namespace: "staging-workspaces", FieldManager: "workspace-manager"}}
+	payload := models.WorkspaceSettings{Name: "staging-ws", Status: "creating"}
+
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, false))
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKey{Name: "staging-ws", Namespace: "staging-workspaces"}, &v1alpha1.Workspace{}))
+
+	payload.Status = "deleting"
+	assert.NoError(t, ProcessWorkspace(ctx, fakeClient, cfg, payload, false))
+	getErr := fakeClient.Get(ctx, client.ObjectKey{Name: "staging-ws", Namespace: "staging-workspaces"}, &v1alpha1.Workspace{})
+	assert.True(t, apierrors.IsNotFound(getErr))
+}
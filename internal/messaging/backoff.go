@@ -0,0 +1,27 @@
+package messaging
+
+import (
+	"time"
+)
+
+// ExponentialBackoff is a pulsar.NackBackoffPolicy that doubles the redelivery delay on each attempt
+type ExponentialBackoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Next returns the delay before the message is redelivered for the given redelivery count
+func (b ExponentialBackoff) Next(redeliveryCount uint32) time.Duration {
+	delay := b.Initial
+	for i := uint32(0); i < redeliveryCount; i++ {
+		delay *= 2
+		if delay >= b.Max || delay <= 0 {
+			return b.Max
+		}
+	}
+
+	if delay > b.Max {
+		return b.Max
+	}
+	return delay
+}
@@ -0,0 +1,18 @@
+package messaging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff{Initial: time.Second, Max: 10 * time.Second}
+
+	assert.Equal(t, time.Second, backoff.Next(0))
+	assert.Equal(t, 2*time.Second, backoff.Next(1))
+	assert.Equal(t, 8*time.Second, backoff.Next(3))
+	assert.Equal(t, 10*time.Second, backoff.Next(4))
+	assert.Equal(t, 10*time.Second, backoff.Next(100))
+}
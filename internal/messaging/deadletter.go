@@ -0,0 +1,95 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/transport"
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons a message is sent to the dead-letter topic
+const (
+	ReasonMalformedPayload   = "malformed-payload"
+	ReasonUnsupportedVersion = "unsupported-schema-version"
+	ReasonRetriesExhausted   = "retries-exhausted"
+	ReasonInvalidSettings    = "invalid-settings"
+)
+
+// Properties added to dead-lettered messages alongside the original properties
+const (
+	PropertyReason          = "dlq-reason"
+	PropertyError           = "dlq-error"
+	PropertyOriginalTopic   = "dlq-original-topic"
+	PropertyOriginalID      = "dlq-original-message-id"
+	PropertyRedeliveryCount = "dlq-redelivery-count"
+	PropertyFailedAt        = "dlq-failed-at"
+)
+
+// DeadLetterQueue publishes messages that could not be processed to a dead-letter topic
+type DeadLetterQueue struct {
+	sink transport.StatusSink
+}
+
+// NewDeadLetterQueue creates a DeadLetterQueue that publishes to the given sink
+func NewDeadLetterQueue(sink transport.StatusSink) *DeadLetterQueue {
+	return &DeadLetterQueue{sink: sink}
+}
+
+// Send publishes the original payload of msg to the dead-letter topic along with error metadata
+func (d *DeadLetterQueue) Send(ctx context.Context, msg transport.Message, reason string, cause error) error {
+	if err := d.sink.Send(ctx, buildDeadLetterMessage(msg, reason, cause)); err != nil {
+		return fmt.Errorf("failed to publish message %s to dead-letter topic: %w", msg.ID(), err)
+	}
+
+	log.Warn().Str("reason", reason).Str("message_id", msg.ID()).Err(cause).Msg("Message sent to dead-letter topic")
+	return nil
+}
+
+// buildDeadLetterMessage copies the payload, key and properties of msg and annotates it with the failure details
+func buildDeadLetterMessage(msg transport.Message, reason string, cause error) *transport.OutgoingMessage {
+	properties := make(map[string]string, len(msg.Properties())+6)
+	for k, v := range msg.Properties() {
+		properties[k] = v
+	}
+
+	properties[PropertyReason] = reason
+	properties[PropertyOriginalTopic] = msg.Topic()
+	properties[PropertyOriginalID] = msg.ID()
+	properties[PropertyRedeliveryCount] = strconv.FormatUint(uint64(msg.RedeliveryCount()), 10)
+	properties[PropertyFailedAt] = time.Now().UTC().Format(time.RFC3339)
+	if cause != nil {
+		properties[PropertyError] = cause.Error()
+	}
+
+	return &transport.OutgoingMessage{
+		Payload:    msg.Payload(),
+		Key:        msg.Key(),
+		Properties: properties,
+	}
+}
+
+// Settle acknowledges a successfully processed message, or dead-letters one that failed and will
+// not be retried. It returns the resulting outcome for metrics.
+func (d *DeadLetterQueue) Settle(ctx context.Context, source transport.SettingsSource, msg transport.Message, cause error) string {
+	if cause == nil {
+		source.Ack(msg)
+		return metrics.OutcomeAcked
+	}
+	return d.Reject(ctx, source, msg, ReasonRetriesExhausted, cause)
+}
+
+// Reject sends msg to the dead-letter topic and acknowledges it. If publishing fails the message
+// is nacked instead so that it is not lost. It returns the resulting outcome for metrics.
+func (d *DeadLetterQueue) Reject(ctx context.Context, source transport.SettingsSource, msg transport.Message, reason string, cause error) string {
+	if err := d.Send(ctx, msg, reason, cause); err != nil {
+		log.Error().Err(err).Msg("Failed to dead-letter message; it will be redelivered")
+		source.Nack(msg)
+		return metrics.OutcomeNacked
+	}
+	source.Ack(msg)
+	return metrics.OutcomeDeadLettered
+}
@@ -0,0 +1,75 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/metrics"
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMessage is a transport.Message for dead-lettering tests
+type fakeMessage struct {
+	payload         []byte
+	key             string
+	properties      map[string]string
+	redeliveryCount uint32
+}
+
+func (m fakeMessage) Topic() string                 { return "workspace-settings" }
+func (m fakeMessage) Payload() []byte               { return m.payload }
+func (m fakeMessage) Key() string                   { return m.key }
+func (m fakeMessage) Properties() map[string]string { return m.properties }
+func (m fakeMessage) RedeliveryCount() uint32       { return m.redeliveryCount }
+func (m fakeMessage) ID() string                    { return "1" }
+
+func TestBuildDeadLetterMessage(t *testing.T) {
+	msg := fakeMessage{
+		payload:         []byte(`{"name":"demo"}`),
+		key:             "demo",
+		properties:      map[string]string{"trace": "abc"},
+		redeliveryCount: 5,
+	}
+
+	out := buildDeadLetterMessage(msg, ReasonRetriesExhausted, errors.New("boom"))
+
+	assert.Equal(t, msg.payload, out.Payload)
+	assert.Equal(t, "demo", out.Key)
+	assert.Equal(t, "abc", out.Properties["trace"])
+	assert.Equal(t, ReasonRetriesExhausted, out.Properties[PropertyReason])
+	assert.Equal(t, "boom", out.Properties[PropertyError])
+	assert.Equal(t, "workspace-settings", out.Properties[PropertyOriginalTopic])
+	assert.Equal(t, "5", out.Properties[PropertyRedeliveryCount])
+	assert.NotEmpty(t, out.Properties[PropertyFailedAt])
+
+	// The original message properties must not be modified
+	assert.Len(t, msg.properties, 1)
+}
+
+func TestSettle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := transport.NewMemoryBus()
+	tr := bus.Transport(ExponentialBackoff{Initial: time.Millisecond, Max: time.Millisecond})
+	defer tr.Close()
+	deadLetters := NewDeadLetterQueue(tr.DeadLetter)
+	assert.NoError(t, bus.Sink(transport.MemoryTopicSettings).Send(ctx, &transport.OutgoingMessage{Key: "demo", Payload: []byte(`{"name":"demo"}`)}))
+
+	// A failed message is dead-lettered with its redelivery count
+	msg, err := tr.Settings.Receive(ctx)
+	assert.NoError(t, err)
+	tr.Settings.Nack(msg)
+	msg, err = tr.Settings.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.OutcomeDeadLettered, deadLetters.Settle(ctx, tr.Settings, msg, errors.New("boom")))
+
+	dead, err := bus.Source(transport.MemoryTopicDeadLetter, ExponentialBackoff{}).Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"demo"}`, string(dead.Payload()))
+	assert.Equal(t, ReasonRetriesExhausted, dead.Properties()[PropertyReason])
+	assert.Equal(t, "1", dead.Properties()[PropertyRedeliveryCount])
+}
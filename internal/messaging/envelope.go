@@ -0,0 +1,156 @@
+package messaging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/rs/zerolog/log"
+)
+
+// CurrentSchemaVersion is the workspace-settings schema version the manager processes. Messages
+// with older versions are upgraded to it as they are decoded.
+const CurrentSchemaVersion = 2
+
+// ErrUnsupportedVersion is returned when a message has a schema version with no decoder
+var ErrUnsupportedVersion = errors.New("unsupported schema version")
+
+// settingsSchema decodes one version of the workspace-settings payload
+type settingsSchema struct {
+	// decode parses a payload of this version
+	decode func(payload []byte) (any, error)
+	// upgrade converts a decoded payload of this version to the next version. The current version
+	// has none.
+	upgrade func(payload any) (any, error)
+}
+
+// settingsSchemas holds the decoder for each supported schema version
+type settingsSchemas map[int]settingsSchema
+
+// schemas are the workspace-settings schema versions the manager accepts.
+//
+// Version 1 is the original message: a bare WorkspaceSettings object without an envelope. Unknown
+// fields are logged and ignored, as they always have been.
+//
+// Version 2 wraps WorkspaceSettings in an Envelope. Unknown fields are rejected, so producers must
+// bump the schema version when they add fields.
+var schemas = settingsSchemas{
+	1: {decode: decodeSettingsV1, upgrade: upgradeSettingsV1},
+	2: {decode: decodeSettingsV2},
+}
+
+// DecodeSettings decodes a workspace-settings message, upgrading its payload to the current schema
+// version. A message without an envelope is treated as a version 1 payload and given an envelope
+// with no metadata. Messages with a version that is not supported return ErrUnsupportedVersion.
+func DecodeSettings(data []byte) (models.Envelope, models.WorkspaceSettings, error) {
+	return schemas.decode(data, CurrentSchemaVersion)
+}
+
+// decode decodes a message and upgrades its payload, one version at a time, to current
+func (s settingsSchemas) decode(data []byte, current int) (models.Envelope, models.WorkspaceSettings, error) {
+	envelope, err := s.decodeEnvelope(data, current)
+	if err != nil {
+		return envelope, models.WorkspaceSettings{}, err
+	}
+
+	payload, err := s[envelope.SchemaVersion].decode(envelope.Payload)
+	if err != nil {
+		return envelope, models.WorkspaceSettings{}, fmt.Errorf("invalid schema version %d payload: %w", envelope.SchemaVersion, err)
+	}
+	for version := envelope.SchemaVersion; version < current; version++ {
+		upgrade := s[version].upgrade
+		if upgrade == nil {
+			return envelope, models.WorkspaceSettings{}, fmt.Errorf("%w %d: no upgrade to version %d", ErrUnsupportedVersion, envelope.SchemaVersion, version+1)
+		}
+		if payload, err = upgrade(payload); err != nil {
+			return envelope, models.WorkspaceSettings{}, fmt.Errorf("failed to upgrade payload from schema version %d: %w", version, err)
+		}
+	}
+
+	settings, ok := payload.(models.WorkspaceSettings)
+	if !ok {
+		return envelope, models.WorkspaceSettings{}, fmt.Errorf("schema version %d decoded to %T rather than WorkspaceSettings", current, payload)
+	}
+	return envelope, settings, nil
+}
+
+// decodeEnvelope parses the envelope of a message, checking its schema version before anything
+// else so that messages from newer producers are reported as unsupported rather than malformed
+func (s settingsSchemas) decodeEnvelope(data []byte, current int) (models.Envelope, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return models.Envelope{}, err
+	}
+
+	// Messages from before the envelope was introduced are the bare payload
+	rawVersion, ok := fields["schema_version"]
+	if !ok {
+		return models.Envelope{SchemaVersion: 1, Payload: data}, nil
+	}
+
+	var version int
+	if err := json.Unmarshal(rawVersion, &version); err != nil {
+		return models.Envelope{}, fmt.Errorf("invalid schema_version: %w", err)
+	}
+	if _, ok := s[version]; !ok || version > current {
+		return models.Envelope{SchemaVersion: version}, fmt.Errorf("%w %d", ErrUnsupportedVersion, version)
+	}
+
+	var envelope models.Envelope
+	if err := decodeStrict(data, &envelope); err != nil {
+		return envelope, fmt.Errorf("invalid envelope: %w", err)
+	}
+	if envelope.MessageID == "" {
+		return envelope, errors.New("envelope has no message_id")
+	}
+	if len(envelope.Payload) == 0 {
+		return envelope, errors.New("envelope has no payload")
+	}
+	return envelope, nil
+}
+
+// decodeSettingsV1 parses a version 1 payload, logging rather than rejecting unknown fields
+func decodeSettingsV1(payload []byte) (any, error) {
+	var settings models.WorkspaceSettings
+	strictErr := decodeStrict(payload, &settings)
+	if strictErr == nil {
+		return settings, nil
+	}
+
+	settings = models.WorkspaceSettings{}
+	if err := json.Unmarshal(payload, &settings); err != nil {
+		return nil, err
+	}
+	log.Warn().Err(strictErr).Str("workspace", settings.Name).Msg("Ignoring unknown fields in version 1 workspace-settings message")
+	return settings, nil
+}
+
+// upgradeSettingsV1 converts a version 1 payload to version 2, which has the same fields
+func upgradeSettingsV1(payload any) (any, error) {
+	return payload, nil
+}
+
+// decodeSettingsV2 parses a version 2 payload
+func decodeSettingsV2(payload []byte) (any, error) {
+	var settings models.WorkspaceSettings
+	if err := decodeStrict(payload, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// decodeStrict parses a single JSON value into v, failing on fields v does not have
+func decodeStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package messaging
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSettingsLegacy(t *testing.T) {
+	// Messages without an envelope are version 1, and unknown fields are ignored
+	envelope, settings, err := DecodeSettings([]byte(`{"name":"demo","status":"creating","colour":"blue"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, envelope.SchemaVersion)
+	assert.Empty(t, envelope.MessageID)
+	assert.Equal(t, "demo", settings.Name)
+	assert.Equal(t, "creating", settings.Status)
+
+	_, _, err = DecodeSettings([]byte(`{"name":`))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestDecodeSettingsEnvelope(t *testing.T) {
+	data := []byte(`{
+		"schema_version": 2,
+		"message_id": "c7a3",
+		"correlation_id": "req-42",
+		"emitted_at": "2025-02-01T12:00:00Z",
+		"payload": {"name": "demo", "status": "updating"}
+	}`)
+	envelope, settings, err := DecodeSettings(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, envelope.SchemaVersion)
+	assert.Equal(t, "c7a3", envelope.MessageID)
+	assert.Equal(t, "req-42", envelope.CorrelationID)
+	assert.Equal(t, time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC), envelope.EmittedAt)
+	assert.Equal(t, "demo", settings.Name)
+
+	// Version 1 payloads can be enveloped too
+	_, settings, err = DecodeSettings([]byte(`{"schema_version":1,"message_id":"c7a4","payload":{"name":"demo","colour":"blue"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "demo", settings.Name)
+}
+
+func TestDecodeSettingsRejects(t *testing.T) {
+	for name, data := range map[string]string{
+		"unknown payload field":  `{"schema_version":2,"message_id":"a","payload":{"name":"demo","colour":"blue"}}`,
+		"unknown envelope field": `{"schema_version":2,"message_id":"a","priority":1,"payload":{"name":"demo"}}`,
+		"no message_id":          `{"schema_version":2,"payload":{"name":"demo"}}`,
+		"no payload":             `{"schema_version":2,"message_id":"a"}`,
+		"invalid version":        `{"schema_version":"2","message_id":"a","payload":{"name":"demo"}}`,
+	} {
+		_, _, err := DecodeSettings([]byte(data))
+		assert.Error(t, err, name)
+		assert.NotErrorIs(t, err, ErrUnsupportedVersion, name)
+	}
+
+	// Unsupported versions are identified even if the rest of the envelope is unknown
+	for _, data := range []string{
+		`{"schema_version":3,"message_id":"a","signature":"x","payload":{"name":"demo"}}`,
+		`{"schema_version":0,"payload":{"name":"demo"}}`,
+	} {
+		_, _, err := DecodeSettings([]byte(data))
+		assert.ErrorIs(t, err, ErrUnsupportedVersion, data)
+	}
+}
+
+func TestDecodeSettingsUpgrade(t *testing.T) {
+	// A version 1 payload that named the workspace "workspace" rather than "name"
+	type settingsV1 struct {
+		Workspace string `json:"workspace"`
+	}
+	s := settingsSchemas{
+		1: {
+			decode: func(payload []byte) (any, error) {
+				var v1 settingsV1
+				err := json.Unmarshal(payload, &v1)
+				return v1, err
+			},
+			upgrade: func(payload any) (any, error) {
+				return map[string]string{"name": payload.(settingsV1).Workspace}, nil
+			},
+		},
+		2: {
+			decode: func(payload []byte) (any, error) { return nil, nil },
+			upgrade: func(payload any) (any, error) {
+				return models.WorkspaceSettings{Name: payload.(map[string]string)["name"]}, nil
+			},
+		},
+		3: {decode: decodeSettingsV2},
+	}
+
+	// Each upgrade is applied in turn
+	envelope, settings, err := s.decode([]byte(`{"workspace":"demo"}`), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, envelope.SchemaVersion)
+	assert.Equal(t, "demo", settings.Name)
+
+	_, settings, err = s.decode([]byte(`{"schema_version":3,"message_id":"a","payload":{"name":"demo"}}`), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "demo", settings.Name)
+
+	// Versions newer than the current one are unsupported even if a decoder exists
+	_, _, err = s.decode([]byte(`{"schema_version":3,"message_id":"a","payload":{"name":"demo"}}`), 2)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
@@ -0,0 +1,60 @@
+package messaging
+
+import (
+	"sync"
+)
+
+// KeySerializer runs submitted work concurrently across keys but strictly in submission order for
+// any single key. It is used to process workspace-settings messages for different workspaces in
+// parallel while keeping the events for one workspace sequential.
+type KeySerializer struct {
+	mu     sync.Mutex
+	queues map[string][]func()
+	wg     sync.WaitGroup
+}
+
+// NewKeySerializer creates an empty KeySerializer
+func NewKeySerializer() *KeySerializer {
+	return &KeySerializer{queues: make(map[string][]func())}
+}
+
+// Submit schedules fn to run once all work previously submitted for key has finished
+func (s *KeySerializer) Submit(key string, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wg.Add(1)
+
+	// A worker is already running for this key so queue behind it
+	if queue, ok := s.queues[key]; ok {
+		s.queues[key] = append(queue, fn)
+		return
+	}
+
+	s.queues[key] = nil
+	go s.run(key, fn)
+}
+
+// Wait blocks until all submitted work has completed
+func (s *KeySerializer) Wait() {
+	s.wg.Wait()
+}
+
+// run executes fn and then drains the queue for key, removing the key once it is empty
+func (s *KeySerializer) run(key string, fn func()) {
+	for fn != nil {
+		fn()
+
+		s.mu.Lock()
+		if queue := s.queues[key]; len(queue) > 0 {
+			fn = queue[0]
+			s.queues[key] = queue[1:]
+		} else {
+			delete(s.queues, key)
+			fn = nil
+		}
+		s.mu.Unlock()
+
+		s.wg.Done()
+	}
+}
@@ -0,0 +1,59 @@
+package messaging
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySerializerOrdersWorkPerKey(t *testing.T) {
+	s := NewKeySerializer()
+
+	var mu sync.Mutex
+	results := map[string][]int{}
+
+	for i := 0; i < 50; i++ {
+		for _, key := range []string{"ws-a", "ws-b"} {
+			i, key := i, key
+			s.Submit(key, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				results[key] = append(results[key], i)
+			})
+		}
+	}
+	s.Wait()
+
+	for _, key := range []string{"ws-a", "ws-b"} {
+		assert.Len(t, results[key], 50)
+		for i, v := range results[key] {
+			assert.Equal(t, i, v)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Empty(t, s.queues)
+}
+
+func TestKeySerializerRunsKeysConcurrently(t *testing.T) {
+	s := NewKeySerializer()
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	// Block the first key until the second key has run
+	s.Submit("ws-a", func() { <-release })
+	s.Submit("ws-b", func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("work for ws-b was blocked by ws-a")
+	}
+
+	close(release)
+	s.Wait()
+}
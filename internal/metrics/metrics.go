@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "workspace_manager"
+
+// Outcomes of a workspace-settings message once it has been handled
+const (
+	OutcomeAcked        = "acked"
+	OutcomeNacked       = "nacked"
+	OutcomeRetried      = "retried"
+	OutcomeDeadLettered = "dead_lettered"
+)
+
+// OperationDryRun is the operation label of a ProcessWorkspace call that only diffs the workspace
+const OperationDryRun = "dry-run"
+
+var (
+	// SettingsMessagesReceived counts workspace-settings messages received, by status
+	SettingsMessagesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "settings_messages_received_total",
+		Help:      "Number of workspace-settings messages received.",
+	}, []string{"status"})
+
+	// SettingsMessagesAcked counts workspace-settings messages acknowledged, by status
+	SettingsMessagesAcked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "settings_messages_acked_total",
+		Help:      "Number of workspace-settings messages acknowledged.",
+	}, []string{"status"})
+
+	// SettingsMessagesNacked counts workspace-settings messages negatively acknowledged, by status
+	SettingsMessagesNacked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "settings_messages_nacked_total",
+		Help:      "Number of workspace-settings messages negatively acknowledged for redelivery.",
+	}, []string{"status"})
+
+	// SettingsMessagesRetried counts failed attempts to process workspace-settings messages that are retried, by status
+	SettingsMessagesRetried = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "settings_messages_retried_total",
+		Help:      "Number of failed attempts to process a workspace-settings message that were retried.",
+	}, []string{"status"})
+
+	// SettingsMessagesDeadLettered counts workspace-settings messages sent to the dead-letter topic, by status
+	SettingsMessagesDeadLettered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "settings_messages_dead_lettered_total",
+		Help:      "Number of workspace-settings messages sent to the dead-letter topic.",
+	}, []string{"status"})
+
+	// ProcessWorkspaceDuration measures how long ProcessWorkspace takes, by operation
+	ProcessWorkspaceDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "process_workspace_duration_seconds",
+		Help:      "Time taken to apply a workspace-settings message to the cluster.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// ProcessWorkspaceErrors counts ProcessWorkspace failures, by operation and error class
+	ProcessWorkspaceErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "process_workspace_errors_total",
+		Help:      "Number of failed attempts to apply a workspace-settings message to the cluster.",
+	}, []string{"operation", "error_class"})
+
+	// ConflictRetries counts Workspace writes retried after an optimistic concurrency conflict
+	ConflictRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "workspace_conflict_retries_total",
+		Help:      "Number of Workspace writes retried because the Workspace changed since it was fetched.",
+	})
+
+	// StatusUpdatesPublished counts workspace-status messages published
+	StatusUpdatesPublished = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_updates_published_total",
+		Help:      "Number of workspace-status messages published.",
+	})
+
+	// StatusUpdatesFailed counts workspace-status messages that could not be serialised or published
+	StatusUpdatesFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_updates_failed_total",
+		Help:      "Number of workspace-status messages that failed to publish.",
+	})
+
+	// StatusUpdatesCoalesced counts workspace-status updates replaced by a newer update for the same workspace before being published
+	StatusUpdatesCoalesced = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_updates_coalesced_total",
+		Help:      "Number of workspace-status updates replaced by a newer update for the same workspace before being published.",
+	})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		SettingsMessagesReceived,
+		SettingsMessagesAcked,
+		SettingsMessagesNacked,
+		SettingsMessagesRetried,
+		SettingsMessagesDeadLettered,
+		ProcessWorkspaceDuration,
+		ProcessWorkspaceErrors,
+		ConflictRetries,
+		StatusUpdatesPublished,
+		StatusUpdatesFailed,
+		StatusUpdatesCoalesced,
+	)
+}
+
+// RegisterStatusChannel exposes the number of status updates waiting to be published
+func RegisterStatusChannel(length func() int) {
+	ctrlmetrics.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "status_channel_length",
+		Help:      "Number of workspace-status updates waiting to be published.",
+	}, func() float64 {
+		return float64(length())
+	}))
+}
+
+// RegisterStatusQueue exposes the number of workspaces with a status update waiting to be forwarded
+func RegisterStatusQueue(length func() int) {
+	ctrlmetrics.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "status_queue_length",
+		Help:      "Number of workspaces with a status update waiting to be forwarded to the status channel.",
+	}, func() float64 {
+		return float64(length())
+	}))
+}
+
+// RegisterInFlight exposes the number of workspace-settings messages received but not yet settled
+func RegisterInFlight(count func() int) {
+	ctrlmetrics.Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "settings_messages_in_flight",
+		Help:      "Number of workspace-settings messages received but not yet settled.",
+	}, func() float64 {
+		return float64(count())
+	}))
+}
+
+// ObserveOutcome records how a workspace-settings message with the given status was settled or retried
+func ObserveOutcome(status, outcome string) {
+	switch outcome {
+	case OutcomeAcked:
+		SettingsMessagesAcked.WithLabelValues(StatusLabel(status)).Inc()
+	case OutcomeNacked:
+		SettingsMessagesNacked.WithLabelValues(StatusLabel(status)).Inc()
+	case OutcomeRetried:
+		SettingsMessagesRetried.WithLabelValues(StatusLabel(status)).Inc()
+	case OutcomeDeadLettered:
+		SettingsMessagesDeadLettered.WithLabelValues(StatusLabel(status)).Inc()
+	}
+}
+
+// ObserveProcessWorkspace records the duration of a ProcessWorkspace call and its error class if it failed
+func ObserveProcessWorkspace(operation string, start time.Time, errorClass string) {
+	operation = OperationLabel(operation)
+	ProcessWorkspaceDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if errorClass != "" {
+		ProcessWorkspaceErrors.WithLabelValues(operation, errorClass).Inc()
+	}
+}
+
+// OperationLabel limits the operation label to the known statuses and dry runs
+func OperationLabel(operation string) string {
+	if operation == OperationDryRun {
+		return operation
+	}
+	return StatusLabel(operation)
+}
+
+// StatusLabel limits the status label to known values so that bad messages cannot create
+// unbounded label cardinality
+func StatusLabel(status string) string {
+	switch status {
+	case "creating", "updating", "deleting":
+		return status
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveOutcome(t *testing.T) {
+	ObserveOutcome("creating", OutcomeAcked)
+	ObserveOutcome("deleting", OutcomeNacked)
+	ObserveOutcome("updating", OutcomeRetried)
+	ObserveOutcome("bogus", OutcomeDeadLettered)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(SettingsMessagesAcked.WithLabelValues("creating")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(SettingsMessagesNacked.WithLabelValues("deleting")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(SettingsMessagesRetried.WithLabelValues("updating")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(SettingsMessagesDeadLettered.WithLabelValues("unknown")))
+}
+
+func TestStatusLabel(t *testing.T) {
+	assert.Equal(t, "updating", StatusLabel("updating"))
+	assert.Equal(t, "unknown", StatusLabel(""))
+	assert.Equal(t, "unknown", StatusLabel("something-else"))
+}
+
+func TestObserveProcessWorkspace(t *testing.T) {
+	ObserveProcessWorkspace(OperationDryRun, time.Now(), "conflict")
+	assert.Equal(t, 1.0, testutil.ToFloat64(ProcessWorkspaceErrors.WithLabelValues("dry-run", "conflict")))
+
+	assert.Equal(t, "deleting", OperationLabel("deleting"))
+	assert.Equal(t, "unknown", OperationLabel("bogus"))
+}
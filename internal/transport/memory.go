@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Topics of the in-memory transport
+const (
+	MemoryTopicSettings   = "workspace-settings"
+	MemoryTopicStatus     = "workspace-status"
+	MemoryTopicDeadLetter = "workspace-settings-dlq"
+)
+
+// memoryTopicSize is the number of messages a topic holds before the oldest are dropped
+const memoryTopicSize = 1024
+
+// MemoryBus is an in-process broker for tests and local development. Messages are lost when the
+// process exits, and only code in the same process can send or receive them, so a manager run with
+// the memory transport receives no settings messages and nothing reads its status updates.
+type MemoryBus struct {
+	mu     sync.Mutex
+	topics map[string]chan *memoryMessage
+	seq    atomic.Uint64
+}
+
+// NewMemoryBus creates an empty in-memory broker
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{topics: make(map[string]chan *memoryMessage)}
+}
+
+// topic returns the queue for a topic, creating it if needed
+func (b *MemoryBus) topic(name string) chan *memoryMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch, ok := b.topics[name]
+	if !ok {
+		ch = make(chan *memoryMessage, memoryTopicSize)
+		b.topics[name] = ch
+	}
+	return ch
+}
+
+// Source returns a SettingsSource receiving from topic. Nacked messages are redelivered after the
+// delay given by backoff.
+func (b *MemoryBus) Source(topic string, backoff Backoff) SettingsSource {
+	return &memorySource{queue: b.topic(topic), backoff: backoff, closed: make(chan struct{})}
+}
+
+// Sink returns a StatusSink publishing to topic
+func (b *MemoryBus) Sink(topic string) StatusSink {
+	return &memorySink{bus: b, topic: topic, queue: b.topic(topic)}
+}
+
+// Transport returns a Transport over the settings, status and dead-letter topics of the bus
+func (b *MemoryBus) Transport(backoff Backoff) *Transport {
+	return &Transport{
+		Settings:   b.Source(MemoryTopicSettings, backoff),
+		Status:     b.Sink(MemoryTopicStatus),
+		DeadLetter: b.Sink(MemoryTopicDeadLetter),
+	}
+}
+
+// memoryMessage is a message held by a MemoryBus
+type memoryMessage struct {
+	id              string
+	topic           string
+	key             string
+	payload         []byte
+	properties      map[string]string
+	redeliveryCount uint32
+}
+
+func (m *memoryMessage) ID() string                    { return m.id }
+func (m *memoryMessage) Topic() string                 { return m.topic }
+func (m *memoryMessage) Key() string                   { return m.key }
+func (m *memoryMessage) Payload() []byte               { return m.payload }
+func (m *memoryMessage) Properties() map[string]string { return m.properties }
+func (m *memoryMessage) RedeliveryCount() uint32       { return m.redeliveryCount }
+
+// memorySource receives messages from a MemoryBus topic
+type memorySource struct {
+	queue     chan *memoryMessage
+	backoff   Backoff
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *memorySource) Receive(ctx context.Context) (Message, error) {
+	select {
+	case msg := <-s.queue:
+		return msg, nil
+	case <-s.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Ping only fails once the source is closed, as there is no broker to lose
+func (s *memorySource) Ping(context.Context) error {
+	select {
+	case <-s.closed:
+		return ErrClosed
+	default:
+		return nil
+	}
+}
+
+func (s *memorySource) Ack(Message) error {
+	return nil
+}
+
+// Nack puts a copy of msg back on the topic, with its redelivery count incremented, once the
+// backoff has elapsed
+func (s *memorySource) Nack(msg Message) {
+	m := *msg.(*memoryMessage)
+	m.redeliveryCount++
+	time.AfterFunc(s.backoff.Next(msg.RedeliveryCount()), func() {
+		select {
+		case s.queue <- &m:
+		case <-s.closed:
+		}
+	})
+}
+
+func (s *memorySource) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// memorySink publishes messages to a MemoryBus topic
+type memorySink struct {
+	bus   *MemoryBus
+	topic string
+	queue chan *memoryMessage
+}
+
+// Send puts msg on the topic without blocking. Once the topic holds memoryTopicSize messages the
+// oldest is dropped, so that a topic nothing receives from, such as the status topic outside tests,
+// cannot stall the sender.
+func (s *memorySink) Send(ctx context.Context, msg *OutgoingMessage) error {
+	properties := make(map[string]string, len(msg.Properties))
+	for k, v := range msg.Properties {
+		properties[k] = v
+	}
+
+	m := &memoryMessage{
+		id:         strconv.FormatUint(s.bus.seq.Add(1), 10),
+		topic:      s.topic,
+		key:        msg.Key,
+		payload:    msg.Payload,
+		properties: properties,
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for {
+		select {
+		case s.queue <- m:
+			return nil
+		default:
+		}
+
+		// The topic is full, so make room by dropping its oldest message unless a receiver has
+		// taken one in the meantime
+		select {
+		case <-s.queue:
+		default:
+		}
+	}
+}
+
+// Flush returns immediately because Send delivers to the topic synchronously
+func (s *memorySink) Flush(context.Context) error {
+	return nil
+}
+
+func (s *memorySink) Close() {}
@@ -0,0 +1,102 @@
+package transport
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedBackoff redelivers nacked messages after the same delay every time
+type fixedBackoff time.Duration
+
+func (b fixedBackoff) Next(uint32) time.Duration { return time.Duration(b) }
+
+func TestMemoryBusSendReceive(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := NewMemoryBus()
+	tr := bus.Transport(fixedBackoff(0))
+	defer tr.Close()
+
+	properties := map[string]string{"dry-run": "true"}
+	assert.NoError(t, bus.Sink(MemoryTopicSettings).Send(ctx, &OutgoingMessage{Key: "demo", Payload: []byte(`{"name":"demo"}`), Properties: properties}))
+	properties["dry-run"] = "false"
+
+	msg, err := tr.Settings.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "demo", msg.Key())
+	assert.Equal(t, `{"name":"demo"}`, string(msg.Payload()))
+	assert.Equal(t, MemoryTopicSettings, msg.Topic())
+	assert.NotEmpty(t, msg.ID())
+	assert.Equal(t, uint32(0), msg.RedeliveryCount())
+	// Properties are copied when the message is sent
+	assert.Equal(t, "true", msg.Properties()["dry-run"])
+	assert.NoError(t, tr.Settings.Ack(msg))
+
+	// Status updates can be read back from their topic
+	assert.NoError(t, tr.Status.Send(ctx, &OutgoingMessage{Key: "demo", Payload: []byte("ready")}))
+	assert.NoError(t, tr.Status.Flush(ctx))
+	status, err := bus.Source(MemoryTopicStatus, fixedBackoff(0)).Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "ready", string(status.Payload()))
+}
+
+func TestMemoryBusNackRedelivers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	bus := NewMemoryBus()
+	source := bus.Source(MemoryTopicSettings, fixedBackoff(10*time.Millisecond))
+	defer source.Close()
+	assert.NoError(t, bus.Sink(MemoryTopicSettings).Send(ctx, &OutgoingMessage{Key: "demo"}))
+
+	msg, err := source.Receive(ctx)
+	assert.NoError(t, err)
+	source.Nack(msg)
+	redelivered, err := source.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, msg.ID(), redelivered.ID())
+	assert.Equal(t, uint32(1), redelivered.RedeliveryCount())
+
+	source.Nack(redelivered)
+	redelivered, err = source.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), redelivered.RedeliveryCount())
+}
+
+func TestMemoryBusClose(t *testing.T) {
+	source := NewMemoryBus().Source(MemoryTopicSettings, fixedBackoff(0))
+	assert.NoError(t, source.Ping(context.Background()))
+	source.Close()
+	source.Close()
+
+	_, err := source.Receive(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, source.Ping(context.Background()), ErrClosed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewMemoryBus().Source(MemoryTopicSettings, fixedBackoff(0)).Receive(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestMemoryBusSendDropsOldest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Sending to a full topic that nothing receives from drops the oldest message instead of blocking
+	bus := NewMemoryBus()
+	sink := bus.Sink(MemoryTopicStatus)
+	for i := 0; i <= memoryTopicSize; i++ {
+		assert.NoError(t, sink.Send(ctx, &OutgoingMessage{Key: strconv.Itoa(i)}))
+	}
+
+	source := bus.Source(MemoryTopicStatus, fixedBackoff(0))
+	msg, err := source.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", msg.Key())
+}
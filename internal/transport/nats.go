@@ -0,0 +1,244 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsKeyHeader carries the message key, which NATS has no field for
+const natsKeyHeader = "Key"
+
+// openNATS connects to NATS JetStream, consuming workspace-settings messages with a durable
+// consumer and publishing status updates and dead-lettered messages to their subjects. Unlike a
+// Pulsar Key_Shared subscription, replicas sharing the consumer are not assigned workspaces, so
+// messages for the same workspace are only ordered within a replica.
+func openNATS(ctx context.Context, c utils.NATSConfig, backoff Backoff) (*Transport, error) {
+	options := []nats.Option{nats.Name("workspace-manager")}
+	if c.CredsFile != "" {
+		options = append(options, nats.UserCredentials(c.CredsFile))
+	}
+	conn, err := nats.Connect(c.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	consumer, err := js.CreateOrUpdateConsumer(ctx, c.Stream, natsConsumerConfig(c))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create NATS consumer for workspace-settings: %w", err)
+	}
+	messages, err := consumer.Messages()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to workspace-settings: %w", err)
+	}
+
+	return &Transport{
+		Settings:   newNATSSource(conn, messages, c.AckWait, backoff),
+		Status:     &natsSink{conn: conn, js: js, subject: c.SubjectStatus},
+		DeadLetter: &natsSink{conn: conn, js: js, subject: c.SubjectDeadLetter},
+		close:      conn.Close,
+	}, nil
+}
+
+// natsConsumerConfig returns the durable consumer of workspace-settings messages. Redelivery and
+// dead-lettering are handled by Nack and the dead-letter queue, so the consumer redelivers without
+// limit.
+func natsConsumerConfig(c utils.NATSConfig) jetstream.ConsumerConfig {
+	return jetstream.ConsumerConfig{
+		Durable:       c.Consumer,
+		FilterSubject: c.SubjectSettings,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.AckWait,
+	}
+}
+
+// natsMessage adapts a JetStream message to Message
+type natsMessage struct {
+	msg      jetstream.Msg
+	metadata *jetstream.MsgMetadata
+	// stopProgress stops the in-progress acknowledgements sent while the message is held, and
+	// returns once none can be sent
+	stopProgress func()
+}
+
+func (m natsMessage) ID() string      { return strconv.FormatUint(m.metadata.Sequence.Stream, 10) }
+func (m natsMessage) Topic() string   { return m.msg.Subject() }
+func (m natsMessage) Key() string     { return m.msg.Headers().Get(natsKeyHeader) }
+func (m natsMessage) Payload() []byte { return m.msg.Data() }
+
+func (m natsMessage) Properties() map[string]string {
+	properties := make(map[string]string, len(m.msg.Headers()))
+	for k := range m.msg.Headers() {
+		if k != natsKeyHeader {
+			properties[k] = m.msg.Headers().Get(k)
+		}
+	}
+	return properties
+}
+
+func (m natsMessage) RedeliveryCount() uint32 {
+	return uint32(m.metadata.NumDelivered - 1)
+}
+
+// natsSource receives workspace-settings messages from a JetStream consumer
+type natsSource struct {
+	conn     natsConn
+	messages jetstream.MessagesContext
+	backoff  Backoff
+	// progressInterval is how often a message that has not been settled is reported in progress
+	progressInterval time.Duration
+	// held is cancelled when the source is closed, stopping the in-progress acknowledgements, and
+	// holding counts the messages still being reported
+	held      context.Context
+	closeHeld context.CancelFunc
+	holding   sync.WaitGroup
+}
+
+// natsConn is the part of a NATS connection a natsSource uses
+type natsConn interface {
+	Status() nats.Status
+}
+
+// newNATSSource returns a source receiving from messages over conn, which the server redelivers if
+// they are not acknowledged or reported in progress within ackWait
+func newNATSSource(conn natsConn, messages jetstream.MessagesContext, ackWait time.Duration, backoff Backoff) *natsSource {
+	held, closeHeld := context.WithCancel(context.Background())
+	return &natsSource{
+		conn:             conn,
+		messages:         messages,
+		backoff:          backoff,
+		progressInterval: ackWait / 2,
+		held:             held,
+		closeHeld:        closeHeld,
+	}
+}
+
+// Receive returns the next message. Cancelling ctx stops the source, because JetStream cannot
+// interrupt a single wait.
+func (s *natsSource) Receive(ctx context.Context) (Message, error) {
+	stop := context.AfterFunc(ctx, s.messages.Stop)
+	defer stop()
+
+	for {
+		msg, err := s.messages.Next()
+		if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, ErrClosed
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		metadata, err := msg.Metadata()
+		if err != nil {
+			// Only JetStream messages have metadata, so anything else is dropped
+			_ = msg.Term()
+			continue
+		}
+		return s.hold(msg, metadata), nil
+	}
+}
+
+// hold reports msg in progress every progressInterval until it is settled. Messages wait behind
+// earlier ones for their workspace and are retried in the manager, so they can be held for longer
+// than the ack wait, after which the server would redeliver them.
+func (s *natsSource) hold(msg jetstream.Msg, metadata *jetstream.MsgMetadata) natsMessage {
+	ctx, cancel := context.WithCancel(s.held)
+	done := make(chan struct{})
+	s.holding.Add(1)
+	go func() {
+		defer s.holding.Done()
+		defer close(done)
+		ticker := time.NewTicker(s.progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_ = msg.InProgress()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	return natsMessage{msg: msg, metadata: metadata, stopProgress: stop}
+}
+
+func (s *natsSource) Ack(msg Message) error {
+	m := msg.(natsMessage)
+	m.stopProgress()
+	return m.msg.Ack()
+}
+
+// Nack asks the server to redeliver msg once the backoff has elapsed
+func (s *natsSource) Nack(msg Message) {
+	m := msg.(natsMessage)
+	m.stopProgress()
+	_ = m.msg.NakWithDelay(s.backoff.Next(msg.RedeliveryCount()))
+}
+
+// Ping reports whether the connection to NATS is up. JetStream pulls messages over it, so the
+// consumer receives whenever the connection is connected.
+func (s *natsSource) Ping(context.Context) error {
+	if status := s.conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("NATS connection is %s", status)
+	}
+	return nil
+}
+
+// Close stops receiving and reporting held messages in progress, so the server redelivers any
+// that are not settled once the ack wait has elapsed
+func (s *natsSource) Close() {
+	s.closeHeld()
+	s.messages.Stop()
+	s.holding.Wait()
+}
+
+// natsSink publishes messages to a JetStream subject
+type natsSink struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	subject string
+}
+
+// Send publishes msg and waits for the stream to acknowledge it. The key and properties are sent
+// as headers.
+func (s *natsSink) Send(ctx context.Context, msg *OutgoingMessage) error {
+	out := nats.NewMsg(s.subject)
+	out.Data = msg.Payload
+	for k, v := range msg.Properties {
+		out.Header.Set(k, v)
+	}
+	if msg.Key != "" {
+		out.Header.Set(natsKeyHeader, msg.Key)
+	}
+
+	_, err := s.js.PublishMsg(ctx, out)
+	return err
+}
+
+func (s *natsSink) Flush(ctx context.Context) error {
+	return s.conn.FlushWithContext(ctx)
+}
+
+func (s *natsSink) Close() {}
@@ -0,0 +1,200 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeJetStreamMsg is a JetStream message that records how it was acknowledged
+type fakeJetStreamMsg struct {
+	jetstream.Msg
+	msg      *nats.Msg
+	metadata *jetstream.MsgMetadata
+
+	mu         sync.Mutex
+	inProgress int
+	acked      bool
+	nakDelay   time.Duration
+	terminated bool
+}
+
+func newFakeJetStreamMsg(key string, numDelivered uint64) *fakeJetStreamMsg {
+	msg := nats.NewMsg("workspaces.settings")
+	msg.Data = []byte(`{"name":"demo"}`)
+	msg.Header.Set(natsKeyHeader, key)
+	msg.Header.Set("dry-run", "true")
+	return &fakeJetStreamMsg{
+		msg:      msg,
+		metadata: &jetstream.MsgMetadata{Sequence: jetstream.SequencePair{Stream: 42}, NumDelivered: numDelivered},
+	}
+}
+
+func (m *fakeJetStreamMsg) Subject() string      { return m.msg.Subject }
+func (m *fakeJetStreamMsg) Data() []byte         { return m.msg.Data }
+func (m *fakeJetStreamMsg) Headers() nats.Header { return m.msg.Header }
+
+func (m *fakeJetStreamMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	if m.metadata == nil {
+		return nil, jetstream.ErrNotJSMessage
+	}
+	return m.metadata, nil
+}
+
+func (m *fakeJetStreamMsg) InProgress() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inProgress++
+	return nil
+}
+
+func (m *fakeJetStreamMsg) Ack() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acked = true
+	return nil
+}
+
+func (m *fakeJetStreamMsg) NakWithDelay(delay time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nakDelay = delay
+	return nil
+}
+
+func (m *fakeJetStreamMsg) Term() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.terminated = true
+	return nil
+}
+
+func (m *fakeJetStreamMsg) progress() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inProgress
+}
+
+// fakeConn is a NATS connection with a fixed status
+type fakeConn nats.Status
+
+func (c fakeConn) Status() nats.Status { return nats.Status(c) }
+
+// connected is a NATS connection that is up
+var connected = fakeConn(nats.CONNECTED)
+
+// fakeMessages delivers queued JetStream messages until it is stopped
+type fakeMessages struct {
+	queue    chan jetstream.Msg
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func newFakeMessages(msgs ...jetstream.Msg) *fakeMessages {
+	m := &fakeMessages{queue: make(chan jetstream.Msg, len(msgs)), stopped: make(chan struct{})}
+	for _, msg := range msgs {
+		m.queue <- msg
+	}
+	return m
+}
+
+func (m *fakeMessages) Next() (jetstream.Msg, error) {
+	select {
+	case msg := <-m.queue:
+		return msg, nil
+	case <-m.stopped:
+		return nil, jetstream.ErrMsgIteratorClosed
+	}
+}
+
+func (m *fakeMessages) Stop()  { m.stopOnce.Do(func() { close(m.stopped) }) }
+func (m *fakeMessages) Drain() { m.Stop() }
+
+func TestNATSConsumerConfig(t *testing.T) {
+	config := natsConsumerConfig(utils.NATSConfig{Consumer: "workspace-manager", SubjectSettings: "workspaces.settings", AckWait: time.Minute})
+	assert.Equal(t, "workspace-manager", config.Durable)
+	assert.Equal(t, "workspaces.settings", config.FilterSubject)
+	assert.Equal(t, jetstream.AckExplicitPolicy, config.AckPolicy)
+	assert.Equal(t, time.Minute, config.AckWait)
+	assert.Zero(t, config.MaxDeliver)
+}
+
+func TestNATSSourceReceive(t *testing.T) {
+	// Messages without JetStream metadata are terminated and skipped
+	plain := newFakeJetStreamMsg("plain", 1)
+	plain.metadata = nil
+	msg := newFakeJetStreamMsg("demo", 3)
+	source := newNATSSource(connected, newFakeMessages(plain, msg), time.Minute, fixedBackoff(0))
+	defer source.Close()
+
+	received, err := source.Receive(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, plain.terminated)
+	assert.Equal(t, "42", received.ID())
+	assert.Equal(t, "workspaces.settings", received.Topic())
+	assert.Equal(t, "demo", received.Key())
+	assert.Equal(t, `{"name":"demo"}`, string(received.Payload()))
+	assert.Equal(t, map[string]string{"dry-run": "true"}, received.Properties())
+	assert.Equal(t, uint32(2), received.RedeliveryCount())
+
+	assert.NoError(t, source.Ack(received))
+	assert.True(t, msg.acked)
+}
+
+func TestNATSSourceReportsHeldMessagesInProgress(t *testing.T) {
+	msg := newFakeJetStreamMsg("demo", 1)
+	source := newNATSSource(connected, newFakeMessages(msg), 20*time.Millisecond, fixedBackoff(time.Second))
+	defer source.Close()
+
+	received, err := source.Receive(context.Background())
+	assert.NoError(t, err)
+
+	// A message that has not been settled is kept from being redelivered
+	assert.Eventually(t, func() bool { return msg.progress() >= 2 }, time.Second, time.Millisecond)
+
+	// Once it is settled it is no longer reported in progress
+	source.Nack(received)
+	assert.Equal(t, time.Second, msg.nakDelay)
+	settled := msg.progress()
+	time.Sleep(40 * time.Millisecond)
+	assert.Equal(t, settled, msg.progress())
+}
+
+func TestNATSSourceClose(t *testing.T) {
+	msg := newFakeJetStreamMsg("demo", 1)
+	source := newNATSSource(connected, newFakeMessages(msg), 20*time.Millisecond, fixedBackoff(0))
+
+	_, err := source.Receive(context.Background())
+	assert.NoError(t, err)
+
+	// Closing the source stops reporting the held message, leaving it to be redelivered
+	source.Close()
+	_, err = source.Receive(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+	closed := msg.progress()
+	time.Sleep(40 * time.Millisecond)
+	assert.Equal(t, closed, msg.progress())
+
+	// Cancelling the context stops the source
+	source = newNATSSource(connected, newFakeMessages(), time.Minute, fixedBackoff(0))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = source.Receive(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNATSSourcePing(t *testing.T) {
+	source := newNATSSource(connected, newFakeMessages(), time.Minute, fixedBackoff(0))
+	defer source.Close()
+	assert.NoError(t, source.Ping(context.Background()))
+
+	// A connection that is reconnecting cannot receive
+	source.conn = fakeConn(nats.RECONNECTING)
+	assert.ErrorContains(t, source.Ping(context.Background()), "RECONNECTING")
+}
@@ -0,0 +1,186 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/apache/pulsar-client-go/pulsar/auth"
+)
+
+// openPulsar connects to Pulsar, subscribing to the workspace-settings topic and creating
+// producers for the workspace-status and dead-letter topics
+func openPulsar(c utils.PulsarConfig, backoff Backoff) (*Transport, error) {
+	clientOptions, err := ClientOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	client, err := pulsar.NewClient(clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Pulsar client: %w", err)
+	}
+
+	// Producer for workspace-status topic
+	statusProducer, err := client.CreateProducer(pulsar.ProducerOptions{
+		Topic: c.TopicProducer,
+	})
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create Pulsar producer for workspace-status: %w", err)
+	}
+
+	// Producer for the workspace-settings dead-letter topic
+	deadLetterProducer, err := client.CreateProducer(pulsar.ProducerOptions{
+		Topic: c.TopicDeadLetter,
+	})
+	if err != nil {
+		statusProducer.Close()
+		client.Close()
+		return nil, fmt.Errorf("failed to create Pulsar producer for workspace-settings dead-letter topic: %w", err)
+	}
+
+	// Consumer for workspace-settings topic. Key_Shared delivers all messages for a workspace to
+	// the same replica
+	settingsConsumer, err := client.Subscribe(pulsar.ConsumerOptions{
+		Topic:             c.TopicConsumer,
+		SubscriptionName:  c.Subscription,
+		Type:              pulsar.KeyShared,
+		NackBackoffPolicy: backoff,
+	})
+	if err != nil {
+		deadLetterProducer.Close()
+		statusProducer.Close()
+		client.Close()
+		return nil, fmt.Errorf("failed to create Pulsar consumer for workspace-settings: %w", err)
+	}
+
+	return &Transport{
+		Settings:   &pulsarSource{consumer: settingsConsumer},
+		Status:     &pulsarSink{producer: statusProducer},
+		DeadLetter: &pulsarSink{producer: deadLetterProducer},
+		close:      client.Close,
+	}, nil
+}
+
+// pulsarMessage adapts a pulsar.Message to Message
+type pulsarMessage struct {
+	msg pulsar.Message
+}
+
+func (m pulsarMessage) ID() string                    { return m.msg.ID().String() }
+func (m pulsarMessage) Topic() string                 { return m.msg.Topic() }
+func (m pulsarMessage) Key() string                   { return m.msg.Key() }
+func (m pulsarMessage) Payload() []byte               { return m.msg.Payload() }
+func (m pulsarMessage) Properties() map[string]string { return m.msg.Properties() }
+func (m pulsarMessage) RedeliveryCount() uint32       { return m.msg.RedeliveryCount() }
+
+// pulsarSource receives workspace-settings messages from a Pulsar consumer
+type pulsarSource struct {
+	consumer pulsar.Consumer
+}
+
+func (s *pulsarSource) Receive(ctx context.Context) (Message, error) {
+	msg, err := s.consumer.Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pulsarMessage{msg: msg}, nil
+}
+
+func (s *pulsarSource) Ack(msg Message) error {
+	return s.consumer.Ack(msg.(pulsarMessage).msg)
+}
+
+func (s *pulsarSource) Nack(msg Message) {
+	s.consumer.Nack(msg.(pulsarMessage).msg)
+}
+
+// Ping asks the broker for the consumer's last message IDs, which fails if the consumer has lost
+// its connection or been closed. The client gives up after its operation timeout, so ctx bounds
+// how long the caller waits.
+func (s *pulsarSource) Ping(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.consumer.GetLastMessageIDs()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *pulsarSource) Close() {
+	s.consumer.Close()
+}
+
+// pulsarSink publishes messages with a Pulsar producer
+type pulsarSink struct {
+	producer pulsar.Producer
+}
+
+func (s *pulsarSink) Send(ctx context.Context, msg *OutgoingMessage) error {
+	_, err := s.producer.Send(ctx, &pulsar.ProducerMessage{
+		Key:        msg.Key,
+		Payload:    msg.Payload,
+		Properties: msg.Properties,
+	})
+	return err
+}
+
+func (s *pulsarSink) Flush(ctx context.Context) error {
+	return s.producer.FlushWithCtx(ctx)
+}
+
+func (s *pulsarSink) Close() {
+	s.producer.Close()
+}
+
+// ClientOptions returns the Pulsar client options for the configured URL, TLS settings and
+// authentication
+func ClientOptions(c utils.PulsarConfig) (pulsar.ClientOptions, error) {
+	opts := pulsar.ClientOptions{
+		URL:                        c.URL,
+		MaxConnectionsPerBroker:    1,
+		TLSTrustCertsFilePath:      c.TLS.TrustCertsFile,
+		TLSValidateHostname:        c.TLS.ValidateHostname,
+		TLSAllowInsecureConnection: c.TLS.AllowInsecureConnection,
+		TLSCertificateFile:         c.TLS.CertFile,
+		TLSKeyFilePath:             c.TLS.KeyFile,
+	}
+
+	switch c.Auth.Type {
+	case "", utils.PulsarAuthNone:
+	case utils.PulsarAuthToken:
+		// The token file is read each time the client authenticates, so a rotated token is
+		// picked up without a restart
+		if c.Auth.TokenFile != "" {
+			opts.Authentication = pulsar.NewAuthenticationTokenFromFile(c.Auth.TokenFile)
+		} else {
+			opts.Authentication = pulsar.NewAuthenticationToken(c.Auth.Token)
+		}
+	case utils.PulsarAuthOAuth2:
+		provider, err := auth.NewAuthenticationOAuth2WithParams(map[string]string{
+			auth.ConfigParamType:      auth.ConfigParamTypeClientCredentials,
+			auth.ConfigParamIssuerURL: c.Auth.OAuth2.IssuerURL,
+			auth.ConfigParamAudience:  c.Auth.OAuth2.Audience,
+			auth.ConfigParamScope:     c.Auth.OAuth2.Scope,
+			auth.ConfigParamClientID:  c.Auth.OAuth2.ClientID,
+			auth.ConfigParamKeyFile:   c.Auth.OAuth2.PrivateKey,
+		})
+		if err != nil {
+			return opts, fmt.Errorf("failed to configure OAuth2 authentication: %w", err)
+		}
+		opts.Authentication = provider
+	case utils.PulsarAuthTLS:
+		opts.Authentication = pulsar.NewAuthenticationTLS(c.TLS.CertFile, c.TLS.KeyFile)
+	default:
+		return opts, fmt.Errorf("unknown Pulsar authentication type %q", c.Auth.Type)
+	}
+
+	return opts, nil
+}
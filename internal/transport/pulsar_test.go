@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/apache/pulsar-client-go/pulsar/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientOptionsTLS(t *testing.T) {
+	opts, err := ClientOptions(utils.PulsarConfig{
+		URL: "pulsar+ssl://pulsar:6651",
+		TLS: utils.TLSConfig{
+			TrustCertsFile:   "/certs/ca.crt",
+			ValidateHostname: true,
+			CertFile:         "/certs/tls.crt",
+			KeyFile:          "/certs/tls.key",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "pulsar+ssl://pulsar:6651", opts.URL)
+	assert.Equal(t, "/certs/ca.crt", opts.TLSTrustCertsFilePath)
+	assert.True(t, opts.TLSValidateHostname)
+	assert.False(t, opts.TLSAllowInsecureConnection)
+	assert.Equal(t, "/certs/tls.crt", opts.TLSCertificateFile)
+	assert.Equal(t, "/certs/tls.key", opts.TLSKeyFilePath)
+	assert.Nil(t, opts.Authentication)
+
+	opts, err = ClientOptions(utils.PulsarConfig{
+		Auth: utils.AuthConfig{Type: utils.PulsarAuthTLS},
+		TLS:  utils.TLSConfig{CertFile: "/certs/tls.crt", KeyFile: "/certs/tls.key"},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, opts.Authentication)
+}
+
+func TestClientOptionsTokenFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("first\n"), 0o600))
+
+	opts, err := ClientOptions(utils.PulsarConfig{
+		Auth: utils.AuthConfig{Type: utils.PulsarAuthToken, TokenFile: path},
+	})
+	assert.NoError(t, err)
+
+	provider := opts.Authentication.(auth.Provider)
+	data, err := provider.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(data))
+
+	// A rotated token is used the next time the client authenticates
+	assert.NoError(t, os.WriteFile(path, []byte("second\n"), 0o600))
+	data, err = provider.GetData()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+}
+
+func TestClientOptionsOAuth2(t *testing.T) {
+	_, err := ClientOptions(utils.PulsarConfig{
+		Auth: utils.AuthConfig{
+			Type: utils.PulsarAuthOAuth2,
+			OAuth2: utils.OAuth2Config{
+				IssuerURL:  "https://auth.example.com",
+				PrivateKey: filepath.Join(t.TempDir(), "missing.json"),
+			},
+		},
+	})
+	assert.ErrorContains(t, err, "OAuth2")
+
+	_, err = ClientOptions(utils.PulsarConfig{Auth: utils.AuthConfig{Type: "kerberos"}})
+	assert.Error(t, err)
+}
+
+// fakeConsumer is a Pulsar consumer whose requests for the last message IDs return err, or block
+// while block is set
+type fakeConsumer struct {
+	pulsar.Consumer
+	err   error
+	block chan struct{}
+}
+
+func (c *fakeConsumer) GetLastMessageIDs() ([]pulsar.TopicMessageID, error) {
+	if c.block != nil {
+		<-c.block
+	}
+	return nil, c.err
+}
+
+func TestPulsarSourcePing(t *testing.T) {
+	consumer := &fakeConsumer{}
+	source := &pulsarSource{consumer: consumer}
+	assert.NoError(t, source.Ping(context.Background()))
+
+	consumer.err = errors.New("connection closed")
+	assert.ErrorContains(t, source.Ping(context.Background()), "connection closed")
+
+	// A broker that does not answer fails the check once ctx is done
+	consumer.block = make(chan struct{})
+	defer close(consumer.block)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, source.Ping(ctx), context.DeadlineExceeded)
+}
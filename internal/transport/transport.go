@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/internal/utils"
+)
+
+// ErrClosed is returned by Receive once a SettingsSource has been closed
+var ErrClosed = errors.New("transport closed")
+
+// Message is a workspace-settings message received from a SettingsSource
+type Message interface {
+	// ID identifies the message within its topic
+	ID() string
+	Topic() string
+	Key() string
+	Payload() []byte
+	Properties() map[string]string
+	// RedeliveryCount is the number of times the message has been delivered before
+	RedeliveryCount() uint32
+}
+
+// SettingsSource delivers workspace-settings messages. Every message received must be either
+// acknowledged or negatively acknowledged, in which case it is redelivered after a backoff.
+type SettingsSource interface {
+	// Receive blocks until a message arrives, ctx is cancelled or the source is closed. It does
+	// not fail while the broker is unreachable, so use Ping to check the connection.
+	Receive(ctx context.Context) (Message, error)
+	// Ping returns an error if the source cannot currently reach the broker
+	Ping(ctx context.Context) error
+	Ack(msg Message) error
+	Nack(msg Message)
+	Close()
+}
+
+// OutgoingMessage is a message published to a StatusSink
+type OutgoingMessage struct {
+	Key        string
+	Payload    []byte
+	Properties map[string]string
+}
+
+// StatusSink publishes messages to a topic, such as workspace-status updates or dead-lettered
+// settings messages
+type StatusSink interface {
+	Send(ctx context.Context, msg *OutgoingMessage) error
+	// Flush waits until every message sent has been published
+	Flush(ctx context.Context) error
+	Close()
+}
+
+// Backoff returns the delay before a message that has been redelivered redeliveryCount times is
+// redelivered again
+type Backoff interface {
+	Next(redeliveryCount uint32) time.Duration
+}
+
+// Transport is the connection to a message broker
+type Transport struct {
+	Settings   SettingsSource
+	Status     StatusSink
+	DeadLetter StatusSink
+	close      func()
+}
+
+// Close closes the source and sinks, then the connection to the broker
+func (t *Transport) Close() {
+	t.Settings.Close()
+	t.Status.Close()
+	t.DeadLetter.Close()
+	if t.close != nil {
+		t.close()
+	}
+}
+
+// Open connects to the configured broker. Nacked settings messages are redelivered according to
+// backoff.
+func Open(ctx context.Context, c *utils.Config, backoff Backoff) (*Transport, error) {
+	switch c.Transport {
+	case "", utils.TransportPulsar:
+		return openPulsar(c.Pulsar, backoff)
+	case utils.TransportNATS:
+		return openNATS(ctx, c.NATS, backoff)
+	case utils.TransportMemory:
+		return NewMemoryBus().Transport(backoff), nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q", c.Transport)
+	}
+}
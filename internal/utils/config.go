@@ -2,19 +2,95 @@ package utils
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v2"
 )
 
 type PulsarConfig struct {
-	URL           string `yaml:"url"`
-	TopicProducer string `yaml:"topicProducer"`
-	TopicConsumer string `yaml:"topicConsumer"`
-	Subscription  string `yaml:"subscription"`
+	URL             string      `yaml:"url"`
+	TopicProducer   string      `yaml:"topicProducer"`
+	TopicConsumer   string      `yaml:"topicConsumer"`
+	TopicDeadLetter string      `yaml:"topicDeadLetter"`
+	Subscription    string      `yaml:"subscription"`
+	Retry           RetryConfig `yaml:"retry"`
+	TLS             TLSConfig   `yaml:"tls"`
+	Auth            AuthConfig  `yaml:"auth"`
+}
+
+// TLSConfig controls the TLS connection to a pulsar+ssl:// URL. CertFile and KeyFile are the
+// client certificate presented for mutual TLS.
+type TLSConfig struct {
+	TrustCertsFile          string `yaml:"trustCertsFile"`
+	ValidateHostname        bool   `yaml:"validateHostname"`
+	AllowInsecureConnection bool   `yaml:"allowInsecureConnection"`
+	CertFile                string `yaml:"certFile"`
+	KeyFile                 string `yaml:"keyFile"`
+}
+
+// Pulsar authentication types that can be selected with pulsar.auth.type
+const (
+	PulsarAuthNone   = "none"
+	PulsarAuthToken  = "token"
+	PulsarAuthOAuth2 = "oauth2"
+	PulsarAuthTLS    = "tls"
+)
+
+// AuthConfig controls how the manager authenticates to Pulsar. A token can be given directly or
+// read from TokenFile, which is re-read whenever the client authenticates so that it can be rotated.
+type AuthConfig struct {
+	Type      string       `yaml:"type"`
+	Token     string       `yaml:"token" secret:"true"`
+	TokenFile string       `yaml:"tokenFile"`
+	OAuth2    OAuth2Config `yaml:"oauth2"`
+}
+
+// OAuth2Config holds the OAuth2 client credentials flow settings. PrivateKey is the path to the
+// JSON credentials file holding the client ID and secret.
+type OAuth2Config struct {
+	IssuerURL  string `yaml:"issuerUrl"`
+	Audience   string `yaml:"audience"`
+	Scope      string `yaml:"scope"`
+	ClientID   string `yaml:"clientId"`
+	PrivateKey string `yaml:"privateKey"`
+}
+
+// NATSConfig controls the connection to NATS JetStream when transport is nats. Settings messages
+// are consumed from SubjectSettings by the durable Consumer, and status updates and dead-lettered
+// messages are published to SubjectStatus and SubjectDeadLetter, which must all belong to Stream.
+// The server redelivers a settings message that has not been acknowledged within AckWait, so the
+// manager reports progress on messages it is still holding well before then.
+type NATSConfig struct {
+	URL               string        `yaml:"url"`
+	CredsFile         string        `yaml:"credsFile"`
+	Stream            string        `yaml:"stream"`
+	SubjectSettings   string        `yaml:"subjectSettings"`
+	SubjectStatus     string        `yaml:"subjectStatus"`
+	SubjectDeadLetter string        `yaml:"subjectDeadLetter"`
+	Consumer          string        `yaml:"consumer"`
+	AckWait           time.Duration `yaml:"ackWait"`
+	Retry             RetryConfig   `yaml:"retry"`
+}
+
+// Message transports that can be selected with transport
+const (
+	TransportPulsar = "pulsar"
+	TransportNATS   = "nats"
+	TransportMemory = "memory"
+)
+
+// RetryConfig controls how failed workspace-settings messages are redelivered
+type RetryConfig struct {
+	MaxRedeliveries uint32        `yaml:"maxRedeliveries"`
+	InitialBackoff  time.Duration `yaml:"initialBackoff"`
+	MaxBackoff      time.Duration `yaml:"maxBackoff"`
 }
 
 type AWSConfig struct {
@@ -23,30 +99,109 @@ type AWSConfig struct {
 	Bucket  string `yaml:"bucket"`
 }
 
+// Storage providers that can be selected with storage.provider
+const (
+	StorageProviderAWS     = "aws"
+	StorageProviderGeneric = "generic"
+)
+
 type StorageConfig struct {
+	Provider     string `yaml:"provider"`
+	Bucket       string `yaml:"bucket"`
 	Size         string `yaml:"size"`
+	Permissions  string `yaml:"permissions"`
 	StorageClass string `yaml:"storageClass"`
 	PVCName      string `yaml:"pvcName"`
 	Driver       string `yaml:"driver"`
 }
 
+// KubernetesConfig controls how the manager writes Workspace CRs
+type KubernetesConfig struct {
+	Namespace       string        `yaml:"namespace"`
+	FieldManager    string        `yaml:"fieldManager"`
+	ForceOwnership  bool          `yaml:"forceOwnership"`
+	ConflictRetries int           `yaml:"conflictRetries"`
+	ConflictBackoff time.Duration `yaml:"conflictBackoff"`
+}
+
+// IdentityConfig controls how POSIX UIDs and GIDs are allocated to workspaces. Allocation is
+// disabled, and every workspace uses 1000, unless a range is set.
+type IdentityConfig struct {
+	MinID     int64  `yaml:"minId"`
+	MaxID     int64  `yaml:"maxId"`
+	ConfigMap string `yaml:"configMap"`
+}
+
+// MetricsConfig controls the Prometheus metrics endpoint
+type MetricsConfig struct {
+	BindAddress string `yaml:"bindAddress"`
+}
+
+// HealthConfig controls the liveness and readiness probe endpoints
+type HealthConfig struct {
+	BindAddress string `yaml:"bindAddress"`
+}
+
 // Config holds the application's configuration
 type Config struct {
-	LogLevel string        `yaml:"logLevel"`
-	Pulsar   PulsarConfig  `yaml:"pulsar"`
-	AWS      AWSConfig     `yaml:"aws"`
-	Storage  StorageConfig `yaml:"storage"`
+	LogLevel          string           `yaml:"logLevel"`
+	ShutdownTimeout   time.Duration    `yaml:"shutdownTimeout"`
+	StatusChannelSize int              `yaml:"statusChannelSize"`
+	MaxInFlight       int              `yaml:"maxInFlight"`
+	DryRun            bool             `yaml:"dryRun"`
+	Transport         string           `yaml:"transport"`
+	Pulsar            PulsarConfig     `yaml:"pulsar"`
+	NATS              NATSConfig       `yaml:"nats"`
+	AWS               AWSConfig        `yaml:"aws"`
+	Storage           StorageConfig    `yaml:"storage"`
+	Kubernetes        KubernetesConfig `yaml:"kubernetes"`
+	Metrics           MetricsConfig    `yaml:"metrics"`
+	Health            HealthConfig     `yaml:"health"`
+	Naming            NamingConfig     `yaml:"naming"`
+	Identity          IdentityConfig   `yaml:"identity"`
 }
 
-// LoadConfig loads the application configuration from a file
-func LoadConfig(configPath string) *Config {
-	// Get the config file path from the environment variable
-	//configPath := "/home/jlangstone/Work/UKEODHP/eodhp-workspace-manager/tmp/config.yaml"
+// Retry returns the redelivery settings of the selected transport
+func (c *Config) Retry() RetryConfig {
+	if c.Transport == TransportNATS {
+		return c.NATS.Retry
+	}
+	return c.Pulsar.Retry
+}
 
-	// Parse the configuration file as a template
-	tmpl, err := template.ParseFiles(configPath)
+// LoadConfig loads the application configuration, exiting if it cannot be read or is invalid
+func LoadConfig(configPath string, overrides map[string]string) *Config {
+	config, err := ReadConfig(configPath, overrides)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error parsing configuration file template")
+		log.Fatal().Err(err).Msg("Invalid configuration file")
+	}
+	return config
+}
+
+// ReadConfig reads the application configuration and validates it. Settings are taken from, in
+// increasing order of precedence, the defaults, the file, WSM_* environment variables and the
+// overrides, which are keyed by setting key.
+func ReadConfig(configPath string, overrides map[string]string) (*Config, error) {
+	config, err := readConfigLayers(configPath, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the values now rather than when the first workspace is processed
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// readConfigLayers reads the application configuration without validating it
+func readConfigLayers(configPath string, overrides map[string]string) (*Config, error) {
+	// Parse the configuration file as a template. Referencing an unset environment variable is an
+	// error rather than rendering "<no value>"
+	tmpl, err := template.New(filepath.Base(configPath)).Option("missingkey=error").ParseFiles(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing configuration file template: %w", err)
 	}
 
 	// Load environment variables into a map
@@ -55,16 +210,88 @@ func LoadConfig(configPath string) *Config {
 	// Execute the template with the environment variables
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, envVars); err != nil {
-		log.Fatal().Err(err).Msg("Error executing configuration file template")
+		return nil, fmt.Errorf("error executing configuration file template: %w", err)
 	}
 
-	// Load the config from the processed template
-	config := &Config{}
+	// Load the config from the processed template over the defaults
+	config := defaultConfig()
 	if err := yaml.Unmarshal(buf.Bytes(), config); err != nil {
-		log.Fatal().Err(err).Msg("Failed to unmarshal configuration file")
+		return nil, fmt.Errorf("failed to unmarshal configuration file: %w", err)
 	}
 
-	return config
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := config.applyOverrides(overrides); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// PrintConfig writes the effective configuration as YAML with secrets masked. It is written even
+// if it is invalid, in which case the problems are returned.
+func PrintConfig(w io.Writer, configPath string, overrides map[string]string) error {
+	config, err := readConfigLayers(configPath, overrides)
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(config.Masked())
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(out); err != nil {
+		return err
+	}
+
+	return config.Validate()
+}
+
+// defaultConfig returns the configuration that the other layers are applied over. Settings that
+// no layer sets keep these values, while a setting explicitly set to zero, such as
+// maxRedeliveries: 0, is kept as zero.
+func defaultConfig() *Config {
+	return &Config{
+		ShutdownTimeout:   30 * time.Second,
+		StatusChannelSize: 100,
+		MaxInFlight:       100,
+		Transport:         TransportPulsar,
+		Pulsar: PulsarConfig{
+			Retry: defaultRetryConfig(),
+			Auth:  AuthConfig{Type: PulsarAuthNone},
+		},
+		NATS: NATSConfig{
+			Consumer: "workspace-manager",
+			AckWait:  30 * time.Second,
+			Retry:    defaultRetryConfig(),
+		},
+		Kubernetes: KubernetesConfig{
+			Namespace:       "workspaces",
+			FieldManager:    "workspace-manager",
+			ConflictRetries: 5,
+			ConflictBackoff: 100 * time.Millisecond,
+		},
+		Metrics: MetricsConfig{BindAddress: ":8080"},
+		Health:  HealthConfig{BindAddress: ":8081"},
+		Naming:  defaultNamingConfig(),
+		Identity: IdentityConfig{
+			ConfigMap: "workspace-manager-identities",
+		},
+		Storage: StorageConfig{
+			Permissions: "755",
+			Provider:    StorageProviderAWS,
+		},
+	}
+}
+
+// defaultRetryConfig returns the default redelivery settings of a transport
+func defaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxRedeliveries: 5,
+		InitialBackoff:  time.Second,
+		MaxBackoff:      5 * time.Minute,
+	}
 }
 
 // loadEnvVars loads environment variables into a map
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// validConfig returns a configuration that passes validation
+func validConfig() *Config {
+	c := defaultConfig()
+	c.Pulsar.URL = "pulsar://pulsar:6650"
+	c.Pulsar.TopicProducer = "workspace-status"
+	c.Pulsar.TopicConsumer = "workspace-settings"
+	c.Pulsar.TopicDeadLetter = "workspace-settings-dlq"
+	c.Pulsar.Subscription = "workspace-manager"
+	c.AWS = AWSConfig{Cluster: "cluster", FSID: "fs-12345", Bucket: "bucket"}
+	c.Storage.Size = "10Gi"
+	c.Storage.StorageClass = "file-storage"
+	c.Storage.Driver = "efs.csi.aws.com"
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, validConfig().Validate())
+
+	generic := validConfig()
+	generic.Storage.Provider = StorageProviderGeneric
+	generic.Storage.Bucket = "minio"
+	generic.AWS = AWSConfig{}
+	assert.NoError(t, generic.Validate())
+
+	c := validConfig()
+	c.Pulsar.URL = "localhost:6650"
+	c.Pulsar.TopicDeadLetter = ""
+	c.AWS.FSID = ""
+	c.Storage.Size = "10GB"
+	c.Storage.Permissions = "rwx"
+	c.Kubernetes.Namespace = "Workspaces"
+	c.Identity.MinID = 2000
+	c.Health.BindAddress = "8081"
+	c.MaxInFlight = 0
+
+	// Every problem is reported
+	err := c.Validate()
+	assert.Error(t, err)
+	for _, key := range []string{
+		"pulsar.url", "pulsar.topicDeadLetter", "aws.fsId", "storage.size", "storage.permissions",
+		"kubernetes.namespace", "identity.minId", "health.bindAddress",
+		"maxInFlight",
+	} {
+		assert.ErrorContains(t, err, key)
+	}
+}
+
+func TestValidatePulsarSecurity(t *testing.T) {
+	c := validConfig()
+	c.Pulsar.URL = "pulsar+ssl://pulsar:6651"
+	c.Pulsar.TLS = TLSConfig{TrustCertsFile: "/certs/ca.crt", CertFile: "/certs/tls.crt", KeyFile: "/certs/tls.key"}
+	c.Pulsar.Auth = AuthConfig{Type: PulsarAuthToken, TokenFile: "/var/run/secrets/pulsar/token"}
+	assert.NoError(t, c.Validate())
+
+	c.Pulsar.URL = "pulsar://pulsar:6650"
+	c.Pulsar.TLS.KeyFile = ""
+	c.Pulsar.Auth.Token = "token"
+	err := c.Validate()
+	assert.ErrorContains(t, err, "pulsar+ssl://")
+	assert.ErrorContains(t, err, "pulsar.tls.keyFile")
+	assert.ErrorContains(t, err, "pulsar.auth.tokenFile")
+
+	c = validConfig()
+	c.Pulsar.Auth = AuthConfig{Type: PulsarAuthOAuth2}
+	err = c.Validate()
+	assert.ErrorContains(t, err, "pulsar.auth.oauth2.issuerUrl")
+	assert.ErrorContains(t, err, "pulsar.auth.oauth2.privateKey")
+}
+
+func TestValidateTransport(t *testing.T) {
+	// Pulsar settings are only required by the Pulsar transport
+	c := validConfig()
+	c.Transport = TransportMemory
+	c.Pulsar = PulsarConfig{}
+	assert.NoError(t, c.Validate())
+
+	c.Transport = TransportNATS
+	c.NATS.Consumer = "workspace.manager"
+	err := c.Validate()
+	for _, key := range []string{"nats.url", "nats.stream", "nats.subjectSettings", "nats.subjectStatus", "nats.subjectDeadLetter", "nats.consumer"} {
+		assert.ErrorContains(t, err, key)
+	}
+	assert.NotContains(t, err.Error(), "pulsar")
+
+	c.NATS = NATSConfig{
+		URL:               "nats://nats:4222",
+		Stream:            "WORKSPACES",
+		SubjectSettings:   "workspaces.settings",
+		SubjectStatus:     "workspaces.status",
+		SubjectDeadLetter: "workspaces.settings.dlq",
+		Consumer:          "workspace-manager",
+		AckWait:           30 * time.Second,
+		Retry:             RetryConfig{MaxRedeliveries: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute},
+	}
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, uint32(3), c.Retry().MaxRedeliveries)
+
+	c.NATS.AckWait = 0
+	assert.ErrorContains(t, c.Validate(), "nats.ackWait")
+	c.NATS.AckWait = 30 * time.Second
+
+	c.Transport = "kafka"
+	assert.ErrorContains(t, c.Validate(), `transport "kafka"`)
+}
+
+func TestReadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("TEST_FS_ID", "fs-from-env")
+
+	err := os.WriteFile(path, []byte(`
+pulsar:
+  url: pulsar://pulsar:6650
+  topicProducer: workspace-status
+  topicConsumer: workspace-settings
+  topicDeadLetter: workspace-settings-dlq
+  subscription: workspace-manager
+  retry:
+    maxRedeliveries: 0
+kubernetes:
+  conflictRetries: 0
+aws:
+  cluster: cluster
+  fsId: {{ .TEST_FS_ID }}
+  bucket: bucket
+storage:
+  size: 10Gi
+  storageClass: file-storage
+  driver: efs.csi.aws.com
+`), 0o600)
+	assert.NoError(t, err)
+
+	c, err := ReadConfig(path, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "fs-from-env", c.AWS.FSID)
+	assert.Equal(t, "workspaces", c.Kubernetes.Namespace)
+
+	// Explicit zeros are kept, while the settings beside them keep their defaults
+	assert.Zero(t, c.Pulsar.Retry.MaxRedeliveries)
+	assert.Equal(t, defaultRetryConfig().MaxBackoff, c.Pulsar.Retry.MaxBackoff)
+	assert.Zero(t, c.Kubernetes.ConflictRetries)
+	assert.Equal(t, 100*time.Millisecond, c.Kubernetes.ConflictBackoff)
+
+	err = os.WriteFile(path, []byte("storage:\n  size: lots\n"), 0o600)
+	assert.NoError(t, err)
+	_, err = ReadConfig(path, nil)
+	assert.ErrorContains(t, err, "storage.size")
+}
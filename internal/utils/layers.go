@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// envPrefix is the prefix of the environment variables that override settings
+const envPrefix = "WSM_"
+
+// secretMask replaces secret values when the configuration is printed
+const secretMask = "********"
+
+// Setting describes a single configuration value and the ways it can be overridden
+type Setting struct {
+	// Key is the dotted YAML path, such as pulsar.topicProducer
+	Key string
+	// EnvVar is the environment variable that overrides the file, such as WSM_PULSAR_TOPIC_PRODUCER
+	EnvVar string
+	// Flag is the command line flag that overrides the environment, such as pulsar.topic-producer
+	Flag string
+	// Secret settings are masked when the configuration is printed
+	Secret bool
+	// Default is the value used when no layer sets the setting, which also gives its type, such as
+	// bool or time.Duration
+	Default any
+}
+
+// Settings lists every configuration value
+func Settings() []Setting {
+	var settings []Setting
+	walkSettings(reflect.ValueOf(defaultConfig()).Elem(), "", func(key string, field reflect.StructField, v reflect.Value) {
+		settings = append(settings, newSetting(key, field, v.Interface()))
+	})
+	return settings
+}
+
+func newSetting(key string, field reflect.StructField, defaultValue any) Setting {
+	segments := strings.Split(key, ".")
+	flags := make([]string, len(segments))
+	envs := make([]string, len(segments))
+	for i, segment := range segments {
+		words := splitCamelCase(segment)
+		flags[i] = strings.ToLower(strings.Join(words, "-"))
+		envs[i] = strings.ToUpper(strings.Join(words, "_"))
+	}
+
+	return Setting{
+		Key:     key,
+		EnvVar:  envPrefix + strings.Join(envs, "_"),
+		Flag:    strings.Join(flags, "."),
+		Secret:  field.Tag.Get("secret") == "true",
+		Default: defaultValue,
+	}
+}
+
+// splitCamelCase splits a YAML key such as s3AccessPoint into its words, s3, Access and Point
+func splitCamelCase(s string) []string {
+	var words []string
+	start := 0
+	for i, r := range s {
+		if i > start && unicode.IsUpper(r) {
+			words = append(words, s[start:i])
+			start = i
+		}
+	}
+	return append(words, s[start:])
+}
+
+// applyEnv overrides settings with the WSM_* environment variables that are set
+func (c *Config) applyEnv() error {
+	for _, setting := range Settings() {
+		if value, ok := os.LookupEnv(setting.EnvVar); ok {
+			if err := c.Set(setting.Key, value); err != nil {
+				return fmt.Errorf("%s: %w", setting.EnvVar, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyOverrides overrides settings with values keyed by setting key, such as those from flags
+func (c *Config) applyOverrides(overrides map[string]string) error {
+	for key, value := range overrides {
+		if err := c.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set parses value into the setting with the given key
+func (c *Config) Set(key, value string) error {
+	found := false
+	var err error
+	walkSettings(reflect.ValueOf(c).Elem(), "", func(k string, _ reflect.StructField, v reflect.Value) {
+		if k == key {
+			found = true
+			err = setValue(v, value)
+		}
+	})
+	if !found {
+		return fmt.Errorf("unknown setting %s", key)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q for %s: %w", value, key, err)
+	}
+	return nil
+}
+
+// setValue parses s into v according to its type
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Masked returns a copy of the configuration with secret settings and URL passwords masked, for
+// printing
+func (c *Config) Masked() *Config {
+	masked := *c
+	walkSettings(reflect.ValueOf(&masked).Elem(), "", func(_ string, field reflect.StructField, v reflect.Value) {
+		if v.Kind() != reflect.String || v.String() == "" {
+			return
+		}
+		if field.Tag.Get("secret") == "true" {
+			v.SetString(secretMask)
+			return
+		}
+		if u, err := url.Parse(v.String()); err == nil && u.User != nil {
+			v.SetString(u.Redacted())
+		}
+	})
+	return &masked
+}
+
+// walkSettings calls fn for every leaf setting in v, a Config or one of its sections, with its
+// dotted YAML key
+func walkSettings(v reflect.Value, prefix string, fn func(key string, field reflect.StructField, v reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if key == "" {
+			key = field.Name
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			walkSettings(v.Field(i), key, fn)
+			continue
+		}
+		fn(key, field, v.Field(i))
+	}
+}
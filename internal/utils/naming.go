@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Default naming templates, matching the names used before they were configurable
+const (
+	DefaultNamespaceTemplate        = "ws-{{.Workspace.Name}}"
+	DefaultRoleNameTemplate         = "{{.AWS.Cluster}}-{{.Workspace.Name}}"
+	DefaultS3AccessPointTemplate    = "{{.AWS.Cluster}}-{{.Workspace.Name}}{{if not .Legacy}}-{{.Store.Name}}{{end}}-s3"
+	DefaultEFSRootDirectoryTemplate = "/workspaces/{{.Store.Name}}"
+	DefaultPVNameTemplate           = "pv-{{.Workspace.Name}}{{if not .Legacy}}-{{.Store.Name}}{{end}}"
+	DefaultPVCNameTemplate          = "pvc-{{.Workspace.Name}}{{if not .Legacy}}-{{.Store.Name}}{{end}}"
+)
+
+// Names of the naming templates, as passed to NamingConfig.Render
+const (
+	NamingNamespace        = "namespace"
+	NamingRoleName         = "roleName"
+	NamingS3AccessPoint    = "s3AccessPoint"
+	NamingEFSRootDirectory = "efsRootDirectory"
+	NamingPVName           = "pvName"
+	NamingPVCName          = "pvcName"
+)
+
+// NamingConfig holds the Go text/template strings used to name the resources of a workspace
+type NamingConfig struct {
+	Namespace        string `yaml:"namespace"`
+	RoleName         string `yaml:"roleName"`
+	S3AccessPoint    string `yaml:"s3AccessPoint"`
+	EFSRootDirectory string `yaml:"efsRootDirectory"`
+	PVName           string `yaml:"pvName"`
+	PVCName          string `yaml:"pvcName"`
+}
+
+// NamingData is the data a naming template is rendered against. Store is the object or block
+// store being named, if any, and Index is its position among the stores of the same kind. Legacy
+// is set for a store whose resource already has the name it was given before workspaces could
+// have several stores, so that the default templates do not rename it.
+type NamingData struct {
+	Workspace models.WorkspaceSettings
+	Store     any
+	Index     int
+	Legacy    bool
+	AWS       AWSConfig
+}
+
+// templates caches parsed naming templates by their source
+var templates sync.Map
+
+// defaultNamingConfig returns the default naming templates
+func defaultNamingConfig() NamingConfig {
+	var n NamingConfig
+	for _, t := range n.templates() {
+		*t.tmpl = t.fallback
+	}
+	return n
+}
+
+// Validate checks that every naming template parses and renders a valid name for the kind of
+// store it is rendered with at runtime
+func (n NamingConfig) Validate() error {
+	for _, t := range n.templates() {
+		data := NamingData{
+			Workspace: models.WorkspaceSettings{ID: uuid.New(), Name: "example"},
+			Store:     t.store,
+			AWS:       AWSConfig{Cluster: "cluster", FSID: "fs-example", Bucket: "bucket"},
+		}
+		// Workspace level names are rendered without a store
+		if t.store != nil {
+			data.Index = 1
+		}
+		if _, err := t.render(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render renders the named template, using its default if it is not configured, and checks that
+// the result is a valid name for the resource
+func (n NamingConfig) Render(name string, data NamingData) (string, error) {
+	for _, t := range n.templates() {
+		if t.name == name {
+			return t.render(data)
+		}
+	}
+	return "", fmt.Errorf("unknown naming template %q", name)
+}
+
+// namingTemplate pairs a configured template with its name and default, an example of the store
+// it is rendered with, if any, and a check of the names it renders
+type namingTemplate struct {
+	name     string
+	tmpl     *string
+	fallback string
+	store    any
+	check    func(string) []string
+}
+
+// templates lists the configurable naming templates
+func (n *NamingConfig) templates() []namingTemplate {
+	objectStore := models.ObjectStore{Name: "example", Bucket: "bucket", Prefix: "example/"}
+	blockStore := models.BlockStore{Name: "example"}
+	return []namingTemplate{
+		{NamingNamespace, &n.Namespace, DefaultNamespaceTemplate, nil, validation.IsDNS1123Label},
+		{NamingRoleName, &n.RoleName, DefaultRoleNameTemplate, nil, isIAMRoleName},
+		{NamingS3AccessPoint, &n.S3AccessPoint, DefaultS3AccessPointTemplate, objectStore, validation.IsDNS1123Label},
+		{NamingEFSRootDirectory, &n.EFSRootDirectory, DefaultEFSRootDirectoryTemplate, blockStore, isAbsolutePath},
+		{NamingPVName, &n.PVName, DefaultPVNameTemplate, blockStore, validation.IsDNS1123Subdomain},
+		{NamingPVCName, &n.PVCName, DefaultPVCNameTemplate, blockStore, validation.IsDNS1123Subdomain},
+	}
+}
+
+// render renders the template and checks the name
+func (t namingTemplate) render(data NamingData) (string, error) {
+	name, err := render(t.name, *t.tmpl, t.fallback, data)
+	if err != nil {
+		return "", err
+	}
+	if problems := t.check(name); len(problems) > 0 {
+		return "", fmt.Errorf("naming template %s rendered invalid name %q: %s", t.name, name, strings.Join(problems, "; "))
+	}
+	return name, nil
+}
+
+// iamRoleName matches the characters and length allowed in an IAM role name
+var iamRoleName = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
+
+// isIAMRoleName checks that name is a valid IAM role name
+func isIAMRoleName(name string) []string {
+	if !iamRoleName.MatchString(name) {
+		return []string{"must be at most 64 letters, digits or any of +=,.@_-"}
+	}
+	return nil
+}
+
+// isAbsolutePath checks that name is a clean absolute path
+func isAbsolutePath(name string) []string {
+	if !path.IsAbs(name) || path.Clean(name) != name {
+		return []string{"must be a clean absolute path"}
+	}
+	return nil
+}
+
+// render executes a naming template, parsing it on first use
+func render(name, source, fallback string, data NamingData) (string, error) {
+	if source == "" {
+		source = fallback
+	}
+
+	var tmpl *template.Template
+	if cached, ok := templates.Load(source); ok {
+		tmpl = cached.(*template.Template)
+	} else {
+		parsed, err := template.New(name).Option("missingkey=error").Parse(source)
+		if err != nil {
+			return "", fmt.Errorf("invalid naming template %s: %w", name, err)
+		}
+		templates.Store(source, parsed)
+		tmpl = parsed
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render naming template %s: %w", name, err)
+	}
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("naming template %s rendered an empty name", name)
+	}
+	return buf.String(), nil
+}
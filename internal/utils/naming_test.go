@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/EO-DataHub/eodhp-workspace-manager/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamingConfigValidate(t *testing.T) {
+	assert.NoError(t, NamingConfig{}.Validate())
+	assert.NoError(t, NamingConfig{PVName: "pv-{{.Workspace.Name}}-{{.Index}}"}.Validate())
+
+	assert.Error(t, NamingConfig{RoleName: "{{.Workspace.Name"}.Validate())
+	assert.Error(t, NamingConfig{PVCName: "{{.Unknown}}"}.Validate())
+	assert.Error(t, NamingConfig{RoleName: "{{if false}}x{{end}}"}.Validate())
+
+	// Workspace level names have no store to render against
+	assert.Error(t, NamingConfig{Namespace: "ws-{{.Store.Name}}"}.Validate())
+
+	// Per-store templates are rendered with the kind of store they name
+	assert.NoError(t, NamingConfig{S3AccessPoint: "{{.Workspace.Name}}-{{.Store.Bucket}}"}.Validate())
+	assert.Error(t, NamingConfig{S3AccessPoint: "{{.Store.MountPoint}}"}.Validate())
+	assert.NoError(t, NamingConfig{PVName: "pv-{{.Store.AccessPointID}}{{.Store.Name}}"}.Validate())
+
+	// Rendered names must be valid for the resource
+	assert.Error(t, NamingConfig{Namespace: "WS_{{.Workspace.Name}}"}.Validate())
+	assert.Error(t, NamingConfig{PVCName: "pvc/{{.Workspace.Name}}"}.Validate())
+	assert.Error(t, NamingConfig{RoleName: "role {{.Workspace.Name}}"}.Validate())
+	assert.Error(t, NamingConfig{EFSRootDirectory: "workspaces/{{.Store.Name}}"}.Validate())
+}
+
+func TestNamingConfigRenderChecksNames(t *testing.T) {
+	n := defaultNamingConfig()
+
+	name, err := n.Render(NamingNamespace, NamingData{Workspace: models.WorkspaceSettings{Name: "demo"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "ws-demo", name)
+
+	// A workspace name that is valid in a message is not necessarily valid in a resource name
+	_, err = n.Render(NamingNamespace, NamingData{Workspace: models.WorkspaceSettings{Name: "Demo_1"}})
+	assert.ErrorContains(t, err, `invalid name "ws-Demo_1"`)
+}
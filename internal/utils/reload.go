@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// immutableSettings are the settings that are only read at startup. Changes to them are ignored
+// on reload, keeping the running values.
+var immutableSettings = []struct {
+	key   string
+	field func(*Config) any
+}{
+	{"transport", func(c *Config) any { return &c.Transport }},
+	{"pulsar", func(c *Config) any { return &c.Pulsar }},
+	{"nats", func(c *Config) any { return &c.NATS }},
+	{"kubernetes.namespace", func(c *Config) any { return &c.Kubernetes.Namespace }},
+	{"kubernetes.fieldManager", func(c *Config) any { return &c.Kubernetes.FieldManager }},
+	{"identity.configMap", func(c *Config) any { return &c.Identity.ConfigMap }},
+	{"metrics", func(c *Config) any { return &c.Metrics }},
+	{"health", func(c *Config) any { return &c.Health }},
+	{"statusChannelSize", func(c *Config) any { return &c.StatusChannelSize }},
+	{"maxInFlight", func(c *Config) any { return &c.MaxInFlight }},
+	{"shutdownTimeout", func(c *Config) any { return &c.ShutdownTimeout }},
+}
+
+// ConfigStore holds the active configuration and replaces it when the configuration file changes.
+// Readers should call Get for each unit of work so that they pick up the latest configuration.
+type ConfigStore struct {
+	path      string
+	overrides map[string]string
+	current   atomic.Pointer[Config]
+}
+
+// NewConfigStore returns a store for the configuration loaded from path with the given overrides,
+// which are applied again on every reload
+func NewConfigStore(path string, overrides map[string]string, c *Config) *ConfigStore {
+	s := &ConfigStore{path: path, overrides: overrides}
+	s.current.Store(c)
+	return s
+}
+
+// Get returns the active configuration, which must not be modified
+func (s *ConfigStore) Get() *Config {
+	return s.current.Load()
+}
+
+// Reload re-reads and validates the configuration file and, if it is valid, makes it the active
+// configuration. Changes to settings that cannot change at runtime are logged and ignored. It
+// reports whether the configuration changed.
+func (s *ConfigStore) Reload() (bool, error) {
+	next, err := ReadConfig(s.path, s.overrides)
+	if err != nil {
+		return false, err
+	}
+	current := s.Get()
+
+	for _, setting := range immutableSettings {
+		old, new := setting.field(current), setting.field(next)
+		if !reflect.DeepEqual(old, new) {
+			log.Warn().Str("setting", setting.key).Msg("Setting cannot be changed without a restart; keeping the running value")
+			reflect.ValueOf(new).Elem().Set(reflect.ValueOf(old).Elem())
+		}
+	}
+
+	changes := DiffConfig(current, next)
+	if len(changes) == 0 {
+		return false, nil
+	}
+
+	s.current.Store(next)
+	log.Info().Strs("changes", changes).Msg("Configuration reloaded")
+	return true, nil
+}
+
+// Watch reloads the configuration whenever the file changes until ctx is cancelled, calling
+// onReload with each new configuration. Invalid configurations are logged and ignored.
+func (s *ConfigStore) Watch(ctx context.Context, onReload func(*Config)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create configuration watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watch the directory rather than the file, because a mounted ConfigMap is updated by swapping
+	// a symlink to a new directory rather than by writing the file
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		return fmt.Errorf("failed to watch configuration file: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+
+			changed, err := s.Reload()
+			if err != nil {
+				log.Error().Err(err).Msg("Invalid configuration file; keeping the running configuration")
+				continue
+			}
+			if changed && onReload != nil {
+				onReload(s.Get())
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Error().Err(err).Msg("Error watching configuration file")
+		}
+	}
+}
+
+// DiffConfig lists the settings that differ between two configurations as key: old -> new
+func DiffConfig(old, new *Config) []string {
+	oldValues, newValues := FlattenConfig(old), FlattenConfig(new)
+
+	var changes []string
+	for key, newValue := range newValues {
+		if oldValue := oldValues[key]; oldValue != newValue {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", key, oldValue, newValue))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// FlattenConfig returns every setting keyed by its dotted YAML path
+func FlattenConfig(c *Config) map[string]string {
+	values := make(map[string]string)
+	walkSettings(reflect.ValueOf(c).Elem(), "", func(key string, _ reflect.StructField, v reflect.Value) {
+		values[key] = fmt.Sprint(v.Interface())
+	})
+	return values
+}
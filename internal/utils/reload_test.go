@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const reloadConfigTemplate = `
+pulsar:
+  url: PULSAR_URL
+  topicProducer: workspace-status
+  topicConsumer: workspace-settings
+  topicDeadLetter: workspace-settings-dlq
+  subscription: workspace-manager
+aws:
+  cluster: cluster
+  fsId: fs-12345
+  bucket: BUCKET
+storage:
+  size: SIZE
+  storageClass: file-storage
+  driver: efs.csi.aws.com
+`
+
+// writeReloadConfig writes a configuration file with the given Pulsar URL, bucket and size
+func writeReloadConfig(t *testing.T, path, pulsarURL, bucket, size string) {
+	t.Helper()
+	content := strings.NewReplacer("PULSAR_URL", pulsarURL, "BUCKET", bucket, "SIZE", size).Replace(reloadConfigTemplate)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestConfigStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeReloadConfig(t, path, "pulsar://pulsar:6650", "bucket", "10Gi")
+
+	c, err := ReadConfig(path, nil)
+	assert.NoError(t, err)
+	store := NewConfigStore(path, nil, c)
+
+	// Unchanged
+	changed, err := store.Reload()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Same(t, c, store.Get())
+
+	// Mutable settings are applied, immutable ones keep their running values
+	writeReloadConfig(t, path, "pulsar://other:6650", "new-bucket", "20Gi")
+	changed, err = store.Reload()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "new-bucket", store.Get().AWS.Bucket)
+	assert.Equal(t, "20Gi", store.Get().Storage.Size)
+	assert.Equal(t, "pulsar://pulsar:6650", store.Get().Pulsar.URL)
+
+	// The previous configuration is not modified
+	assert.Equal(t, "bucket", c.AWS.Bucket)
+
+	// Invalid configurations are rejected
+	writeReloadConfig(t, path, "pulsar://pulsar:6650", "new-bucket", "lots")
+	_, err = store.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, "20Gi", store.Get().Storage.Size)
+}
+
+func TestConfigStoreReloadKeepsOwnership(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeReloadConfig(t, path, "pulsar://pulsar:6650", "bucket", "10Gi")
+
+	c, err := ReadConfig(path, nil)
+	assert.NoError(t, err)
+	store := NewConfigStore(path, nil, c)
+
+	// Changing the field manager or the allocations ConfigMap would orphan the fields and
+	// identities already written, so both keep their running values
+	writeReloadConfig(t, path, "pulsar://pulsar:6650", "new-bucket", "10Gi")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteString("kubernetes:\n  fieldManager: other-manager\nidentity:\n  configMap: other-identities\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	changed, err := store.Reload()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "new-bucket", store.Get().AWS.Bucket)
+	assert.Equal(t, c.Kubernetes.FieldManager, store.Get().Kubernetes.FieldManager)
+	assert.Equal(t, c.Identity.ConfigMap, store.Get().Identity.ConfigMap)
+}
+
+func TestConfigStoreWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeReloadConfig(t, path, "pulsar://pulsar:6650", "bucket", "10Gi")
+
+	c, err := ReadConfig(path, nil)
+	assert.NoError(t, err)
+	store := NewConfigStore(path, nil, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan *Config, 10)
+	done := make(chan error)
+	go func() {
+		done <- store.Watch(ctx, func(c *Config) { reloaded <- c })
+	}()
+
+	// Keep writing until the watcher has been set up and picks up the change
+	assert.Eventually(t, func() bool {
+		writeReloadConfig(t, path, "pulsar://pulsar:6650", "new-bucket", "10Gi")
+		select {
+		case c := <-reloaded:
+			return c.AWS.Bucket == "new-bucket"
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestDiffConfig(t *testing.T) {
+	old := validConfig()
+	new := validConfig()
+	new.Storage.Size = "20Gi"
+	new.Kubernetes.ConflictBackoff = time.Second
+
+	assert.Equal(t, []string{
+		"kubernetes.conflictBackoff: 100ms -> 1s",
+		"storage.size: 10Gi -> 20Gi",
+	}, DiffConfig(old, new))
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// permissionsPattern matches octal file permissions such as 755 or 0750
+var permissionsPattern = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// IsPermissions reports whether s is an octal file mode such as 755 or 0750, as access point
+// permissions must be
+func IsPermissions(s string) bool {
+	return permissionsPattern.MatchString(s)
+}
+
+// pulsarSchemes are the URL schemes the Pulsar client can connect with
+var pulsarSchemes = map[string]bool{"pulsar": true, "pulsar+ssl": true, "http": true, "https": true}
+
+// natsSchemes are the URL schemes the NATS client can connect with
+var natsSchemes = map[string]bool{"nats": true, "tls": true, "ws": true, "wss": true}
+
+// Validate checks the configuration once defaults have been applied and returns every problem
+// found, joined into one error, so that they can all be fixed at once
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	switch c.Transport {
+	case TransportPulsar:
+		c.validatePulsar(v)
+	case TransportNATS:
+		c.validateNATS(v)
+	case TransportMemory:
+	default:
+		v.addf("transport %q is not one of %s, %s, %s", c.Transport, TransportPulsar, TransportNATS, TransportMemory)
+	}
+
+	// Storage
+	switch c.Storage.Provider {
+	case StorageProviderAWS:
+		v.required("aws.cluster", c.AWS.Cluster)
+		v.required("aws.fsId", c.AWS.FSID)
+		v.required("aws.bucket", c.AWS.Bucket)
+		v.required("storage.driver", c.Storage.Driver)
+	case StorageProviderGeneric:
+		v.required("storage.bucket", c.Storage.Bucket)
+	default:
+		v.addf("storage.provider %q is not one of %s, %s", c.Storage.Provider, StorageProviderAWS, StorageProviderGeneric)
+	}
+	if v.required("storage.size", c.Storage.Size) {
+		if _, err := resource.ParseQuantity(c.Storage.Size); err != nil {
+			v.addf("storage.size %q is not a valid quantity: %v", c.Storage.Size, err)
+		}
+	}
+	v.required("storage.storageClass", c.Storage.StorageClass)
+	v.check(IsPermissions(c.Storage.Permissions), "storage.permissions %q is not an octal mode such as 755", c.Storage.Permissions)
+
+	// Kubernetes
+	for _, msg := range validation.IsDNS1123Label(c.Kubernetes.Namespace) {
+		v.addf("kubernetes.namespace %q is invalid: %s", c.Kubernetes.Namespace, msg)
+	}
+	v.required("kubernetes.fieldManager", c.Kubernetes.FieldManager)
+	v.check(c.Kubernetes.ConflictRetries >= 0, "kubernetes.conflictRetries must not be negative")
+
+	// Identity allocation is disabled when no range is set
+	if c.Identity.MinID != 0 || c.Identity.MaxID != 0 {
+		v.check(c.Identity.MinID > 0 && c.Identity.MinID <= c.Identity.MaxID, "identity.minId and identity.maxId must form a range of positive IDs, got %d-%d", c.Identity.MinID, c.Identity.MaxID)
+		v.required("identity.configMap", c.Identity.ConfigMap)
+	}
+
+	// Servers, where "0" disables the metrics endpoint
+	if c.Metrics.BindAddress != "0" {
+		v.address("metrics.bindAddress", c.Metrics.BindAddress)
+	}
+	v.address("health.bindAddress", c.Health.BindAddress)
+
+	v.check(c.ShutdownTimeout > 0, "shutdownTimeout must be positive")
+	v.check(c.StatusChannelSize > 0, "statusChannelSize must be positive")
+	v.check(c.MaxInFlight > 0, "maxInFlight must be positive")
+
+	if err := c.Naming.Validate(); err != nil {
+		v.addf("naming: %v", err)
+	}
+
+	return errors.Join(v.errs...)
+}
+
+// validatePulsar checks the Pulsar settings, which are only used when transport is pulsar
+func (c *Config) validatePulsar(v *validator) {
+	v.url("pulsar.url", c.Pulsar.URL, pulsarSchemes)
+	v.required("pulsar.topicProducer", c.Pulsar.TopicProducer)
+	v.required("pulsar.topicConsumer", c.Pulsar.TopicConsumer)
+	v.required("pulsar.topicDeadLetter", c.Pulsar.TopicDeadLetter)
+	v.required("pulsar.subscription", c.Pulsar.Subscription)
+	validateRetry(v, "pulsar", c.Pulsar.Retry)
+	v.check((c.Pulsar.TLS.CertFile == "") == (c.Pulsar.TLS.KeyFile == ""), "pulsar.tls.certFile and pulsar.tls.keyFile must be set together")
+	if c.Pulsar.TLS != (TLSConfig{}) && !strings.HasPrefix(c.Pulsar.URL, "pulsar+ssl://") && !strings.HasPrefix(c.Pulsar.URL, "https://") {
+		v.addf("pulsar.tls settings require a pulsar+ssl:// or https:// pulsar.url")
+	}
+
+	// Pulsar authentication
+	auth := c.Pulsar.Auth
+	switch auth.Type {
+	case PulsarAuthNone:
+	case PulsarAuthToken:
+		v.check((auth.Token == "") != (auth.TokenFile == ""), "pulsar.auth.token or pulsar.auth.tokenFile, but not both, is required for token authentication")
+	case PulsarAuthOAuth2:
+		v.url("pulsar.auth.oauth2.issuerUrl", auth.OAuth2.IssuerURL, map[string]bool{"http": true, "https": true})
+		v.required("pulsar.auth.oauth2.privateKey", auth.OAuth2.PrivateKey)
+	case PulsarAuthTLS:
+		v.check(c.Pulsar.TLS.CertFile != "", "pulsar.tls.certFile and pulsar.tls.keyFile are required for TLS authentication")
+	default:
+		v.addf("pulsar.auth.type %q is not one of %s, %s, %s, %s", auth.Type, PulsarAuthNone, PulsarAuthToken, PulsarAuthOAuth2, PulsarAuthTLS)
+	}
+}
+
+// validateNATS checks the NATS settings, which are only used when transport is nats
+func (c *Config) validateNATS(v *validator) {
+	v.url("nats.url", c.NATS.URL, natsSchemes)
+	v.required("nats.stream", c.NATS.Stream)
+	v.required("nats.subjectSettings", c.NATS.SubjectSettings)
+	v.required("nats.subjectStatus", c.NATS.SubjectStatus)
+	v.required("nats.subjectDeadLetter", c.NATS.SubjectDeadLetter)
+	v.required("nats.consumer", c.NATS.Consumer)
+	v.check(!strings.ContainsAny(c.NATS.Consumer, ". *>"), "nats.consumer %q must not contain '.', '*', '>' or spaces", c.NATS.Consumer)
+	v.check(c.NATS.AckWait >= time.Second, "nats.ackWait must be at least 1s")
+	validateRetry(v, "nats", c.NATS.Retry)
+}
+
+// validateRetry checks the redelivery settings of a transport
+func validateRetry(v *validator, prefix string, r RetryConfig) {
+	v.check(r.InitialBackoff > 0, "%s.retry.initialBackoff must be positive", prefix)
+	v.check(r.MaxBackoff >= r.InitialBackoff, "%s.retry.maxBackoff must not be less than %s.retry.initialBackoff", prefix, prefix)
+}
+
+// validator collects configuration problems
+type validator struct {
+	errs []error
+}
+
+func (v *validator) addf(format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+// check records a problem unless ok is true
+func (v *validator) check(ok bool, format string, args ...any) {
+	if !ok {
+		v.addf(format, args...)
+	}
+}
+
+// required records a problem if value is empty, and reports whether it was set
+func (v *validator) required(key, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.addf("%s is required", key)
+		return false
+	}
+	return true
+}
+
+// url records a problem if value is not an absolute URL with one of the given schemes
+func (v *validator) url(key, value string, schemes map[string]bool) {
+	if !v.required(key, value) {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		v.addf("%s %q is not a valid URL: %v", key, value, err)
+		return
+	}
+	if !schemes[u.Scheme] || u.Host == "" {
+		v.addf("%s %q must be an absolute URL with a host and a supported scheme", key, value)
+	}
+}
+
+// address records a problem if value is not a host:port listen address
+func (v *validator) address(key, value string) {
+	if !v.required(key, value) {
+		return
+	}
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		v.addf("%s %q is not a valid listen address: %v", key, value, err)
+	}
+}
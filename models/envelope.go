@@ -0,0 +1,15 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Envelope wraps a versioned message payload with metadata identifying the message.
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	MessageID     string          `json:"message_id"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	EmittedAt     time.Time       `json:"emitted_at"`
+	Payload       json.RawMessage `json:"payload"`
+}
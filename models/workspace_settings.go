@@ -41,4 +41,7 @@ type BlockStore struct {
 	Name          string    `json:"name"`
 	AccessPointID string    `json:"access_point_id"`
 	MountPoint    string    `json:"mount_point"`
+	Size          string    `json:"size"`
+	StorageClass  string    `json:"storage_class"`
+	Permissions   string    `json:"permissions"`
 }
@@ -6,8 +6,18 @@ import (
 	workspacev1alpha1 "github.com/EO-DataHub/eodhp-workspace-controller/api/v1alpha1"
 )
 
+// Events that produce a WorkspaceStatus message. EventSynced reports a Workspace that already
+// existed when the manager started, rather than one that was just created.
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+	EventSynced  = "synced"
+)
+
 // WorkspaceStatus represents the status of a Workspace
 type WorkspaceStatus struct {
+	Event       string                      `json:"event"`
 	Name        string                      `json:"name"`
 	Namespace   string                      `json:"namespace"`
 	AWS         workspacev1alpha1.AWSStatus `json:"status"`